@@ -24,7 +24,7 @@ if [ -n "$(command -v apt)" ]; then
     fi
     fi
     tty -s && mesg n
-    EOT
+EOT
 
     service lightdm restart
 
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Prune policies for documents whose source was removed from git
+const (
+	// PruneNone keeps removed documents untouched
+	PruneNone = "none"
+	// PruneDeprecate marks removed documents as deprecated and no longer public
+	PruneDeprecate = "deprecate"
+	// PruneDelete deletes removed documents, unused ones only
+	PruneDelete = "delete"
+)
+
+// defaultFullSyncInterval is the default delay, in hours, between two full syncs
+const defaultFullSyncInterval = 24
+
+// defaultGitDir is the checkout directory of the default source
+const defaultGitDir = "/tmp/goterra-git"
+
+// Secret is a credential, given as value, or read from a file or an environment variable
+type Secret struct {
+	Value string `yaml:"value"`
+	File  string `yaml:"file"`
+	Env   string `yaml:"env"`
+}
+
+// isSet tells if secret is defined
+func (s Secret) isSet() bool {
+	return s.Value != "" || s.File != "" || s.Env != ""
+}
+
+// get returns secret value
+func (s Secret) get() (string, error) {
+	if s.Value != "" {
+		return s.Value, nil
+	}
+	if s.File != "" {
+		data, err := ioutil.ReadFile(s.File)
+		if err != nil {
+			return "", fmt.Errorf("failed to read secret file %s: %s", s.File, err)
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	}
+	if s.Env != "" {
+		value := os.Getenv(s.Env)
+		if value == "" {
+			return "", fmt.Errorf("secret env var %s is not set", s.Env)
+		}
+		return value, nil
+	}
+	return "", nil
+}
+
+// GitAuth defines the credentials to access a git source
+//
+// SSH key (with known hosts check) is used if set, else token or password (HTTPS basic auth)
+type GitAuth struct {
+	Username       string `yaml:"username"`
+	Password       Secret `yaml:"password"`
+	Token          Secret `yaml:"token"`
+	SSHKey         Secret `yaml:"ssh_key"`
+	SSHKeyPassword Secret `yaml:"ssh_key_password"`
+	KnownHosts     string `yaml:"known_hosts"`
+}
+
+// Source is a git repository injected in a namespace
+type Source struct {
+	Name      string   `yaml:"name"`
+	Git       string   `yaml:"git"`
+	Ref       string   `yaml:"ref"`
+	Namespace string   `yaml:"namespace"`
+	Owners    []string `yaml:"owners"`
+	Members   []string `yaml:"members"`
+	Public    bool     `yaml:"public"`
+	Dir       string   `yaml:"dir"`
+	Auth      GitAuth  `yaml:"auth"`
+}
+
+// InjectorConfig defines injector specific options, in injector section of goterra.yml
+type InjectorConfig struct {
+	Prune      string   `yaml:"prune"`
+	HookSecret string   `yaml:"hook_secret"`
+	Ref        string   `yaml:"ref"`
+	Auth       GitAuth  `yaml:"auth"`
+	Sources    []Source `yaml:"sources"`
+	// FullSync disables incremental sync, every pass processes all items
+	FullSync bool `yaml:"full_sync"`
+	// FullSyncInterval is the max delay, in hours, between two full syncs (default 24, negative to disable)
+	FullSyncInterval int `yaml:"full_sync_interval"`
+	// MaxRecipeDepth is the max number of ancestors of a recipe, 0 for no limit, model default if not set
+	MaxRecipeDepth *int `yaml:"max_recipe_depth"`
+}
+
+// InjectorConfigDefinition is the goterra.yml subset read by injector
+type InjectorConfigDefinition struct {
+	Injector InjectorConfig `yaml:"injector"`
+}
+
+// loadInjectorConfig reads injector section of config file (GOT_CONFIG or goterra.yml)
+// and applies environment overrides
+//
+// If no source is defined, defaultGit is injected in public goterra namespace.
+// Returns an error if a source is invalid
+func loadInjectorConfig(defaultGit string) (InjectorConfig, error) {
+	cfgFile := "goterra.yml"
+	if os.Getenv("GOT_CONFIG") != "" {
+		cfgFile = os.Getenv("GOT_CONFIG")
+	}
+	def := InjectorConfigDefinition{}
+	cfg, err := ioutil.ReadFile(cfgFile)
+	if err == nil {
+		if yamlErr := yaml.Unmarshal(cfg, &def); yamlErr != nil {
+			log.Error().Msgf("Failed to read injector config: %s", yamlErr)
+		}
+	}
+	config := def.Injector
+
+	if os.Getenv("GOT_PRUNE") != "" {
+		config.Prune = os.Getenv("GOT_PRUNE")
+	}
+	if os.Getenv("GOT_HOOK_SECRET") != "" {
+		config.HookSecret = os.Getenv("GOT_HOOK_SECRET")
+	}
+	if os.Getenv("GOT_FULL_SYNC") == "1" {
+		config.FullSync = true
+	}
+	if os.Getenv("GOT_MAX_RECIPE_DEPTH") != "" {
+		depth, depthErr := strconv.Atoi(os.Getenv("GOT_MAX_RECIPE_DEPTH"))
+		if depthErr != nil {
+			log.Error().Msgf("Invalid GOT_MAX_RECIPE_DEPTH: %s", depthErr)
+		} else {
+			config.MaxRecipeDepth = &depth
+		}
+	}
+	if os.Getenv("GOT_GIT_REF") != "" {
+		config.Ref = os.Getenv("GOT_GIT_REF")
+	}
+	if config.FullSyncInterval == 0 {
+		config.FullSyncInterval = defaultFullSyncInterval
+	}
+	switch config.Prune {
+	case PruneNone, PruneDeprecate, PruneDelete:
+	case "":
+		config.Prune = PruneDeprecate
+	default:
+		log.Error().Msgf("Invalid prune policy %s, using %s", config.Prune, PruneDeprecate)
+		config.Prune = PruneDeprecate
+	}
+
+	if len(config.Sources) == 0 {
+		config.Sources = []Source{
+			{
+				Name:      "goterra",
+				Git:       defaultGit,
+				Ref:       config.Ref,
+				Namespace: "goterra",
+				Owners:    make([]string, 0),
+				Members:   make([]string, 0),
+				Public:    true,
+				Dir:       defaultGitDir,
+				Auth:      config.Auth,
+			},
+		}
+	}
+	sources := make([]Source, 0)
+	names := make(map[string]bool)
+	namespaces := make(map[string]string)
+	dirs := make(map[string]string)
+	for _, source := range config.Sources {
+		if source.Name == "" || source.Git == "" {
+			return config, fmt.Errorf("source name and git are mandatory, invalid source %+v", source)
+		}
+		if names[source.Name] {
+			return config, fmt.Errorf("source %s defined twice", source.Name)
+		}
+		if source.Namespace == "" {
+			source.Namespace = source.Name
+		}
+		if source.Dir == "" {
+			source.Dir = defaultGitDir + "-" + source.Name
+		}
+		source.Dir = filepath.Clean(source.Dir)
+		// Sources sharing a namespace would prune each other documents, sharing a dir their checkout
+		if namespaces[source.Namespace] != "" {
+			return config, fmt.Errorf("source %s uses namespace %s of source %s", source.Name, source.Namespace, namespaces[source.Namespace])
+		}
+		if dirs[source.Dir] != "" {
+			return config, fmt.Errorf("source %s uses dir %s of source %s", source.Name, source.Dir, dirs[source.Dir])
+		}
+		names[source.Name] = true
+		namespaces[source.Namespace] = source.Name
+		dirs[source.Dir] = source.Name
+		if source.Owners == nil {
+			source.Owners = make([]string, 0)
+		}
+		if source.Members == nil {
+			source.Members = make([]string, 0)
+		}
+		sources = append(sources, source)
+	}
+	config.Sources = sources
+	return config, nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestLoadInjectorConfigSources(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		sources int
+		wantErr bool
+	}{
+		{name: "default source", config: "injector: {}\n", sources: 1},
+		{name: "sources", config: "injector:\n  sources:\n    - name: a\n      git: https://a\n    - name: b\n      git: https://b\n", sources: 2},
+		{name: "missing git", config: "injector:\n  sources:\n    - name: a\n", wantErr: true},
+		{name: "missing name", config: "injector:\n  sources:\n    - git: https://a\n", wantErr: true},
+		{name: "duplicate name", config: "injector:\n  sources:\n    - name: a\n      git: https://a\n    - name: a\n      git: https://b\n", wantErr: true},
+		{name: "shared namespace", config: "injector:\n  sources:\n    - name: a\n      git: https://a\n    - name: b\n      git: https://b\n      namespace: a\n", wantErr: true},
+		{name: "shared dir", config: "injector:\n  sources:\n    - name: a\n      git: https://a\n      dir: /tmp/x\n    - name: b\n      git: https://b\n      dir: /tmp/x/\n", wantErr: true},
+	}
+
+	file, err := ioutil.TempFile("", "goterra-injector")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+	defer os.Remove(file.Name())
+	defer os.Setenv("GOT_CONFIG", os.Getenv("GOT_CONFIG"))
+	os.Setenv("GOT_CONFIG", file.Name())
+
+	for _, test := range tests {
+		if err := ioutil.WriteFile(file.Name(), []byte(test.config), 0644); err != nil {
+			t.Fatal(err)
+		}
+		config, err := loadInjectorConfig("https://default")
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("%s: expected an error", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.name, err)
+			continue
+		}
+		if len(config.Sources) != test.sources {
+			t.Errorf("%s: got %d sources, want %d", test.name, len(config.Sources), test.sources)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	terraGitModel "github.com/osallou/goterra-community/tools/model"
+	terraModel "github.com/osallou/goterra-lib/lib/model"
+)
+
+// injectionMeta is the injection information stored along injected documents
+type injectionMeta struct {
+	// Commit is the git commit the document was injected from
+	Commit string `bson:"commit"`
+	// Hash is the content hash of the files (and references) the document was injected from
+	Hash string `bson:"hash"`
+	// Deprecated is set when document source was removed from git
+	Deprecated bool `bson:"deprecated,omitempty"`
+	// InputSchema is the typed definition of document inputs, inputs only have descriptions
+	InputSchema terraGitModel.Inputs `bson:"inputschema,omitempty"`
+}
+
+// recipeDocument is a recipe as stored by injector
+type recipeDocument struct {
+	terraModel.Recipe `bson:",inline"`
+	Meta              injectionMeta `bson:",inline"`
+}
+
+// templateDocument is a template as stored by injector
+type templateDocument struct {
+	terraModel.Template `bson:",inline"`
+	Meta                injectionMeta `bson:",inline"`
+}
+
+// endpointDocument is an endpoint as stored by injector
+type endpointDocument struct {
+	terraModel.EndPoint `bson:",inline"`
+	Meta                injectionMeta `bson:",inline"`
+}
+
+// applicationDocument is an application as stored by injector
+type applicationDocument struct {
+	terraModel.Application `bson:",inline"`
+	Meta                   injectionMeta `bson:",inline"`
+}
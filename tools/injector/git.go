@@ -0,0 +1,202 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/rs/zerolog/log"
+	"gopkg.in/src-d/go-git.v4"
+	gitConfig "gopkg.in/src-d/go-git.v4/config"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+	githttp "gopkg.in/src-d/go-git.v4/plumbing/transport/http"
+	gitssh "gopkg.in/src-d/go-git.v4/plumbing/transport/ssh"
+)
+
+// authMethod returns the git transport authentication of source, nil for anonymous access
+func authMethod(source Source) (transport.AuthMethod, error) {
+	auth := source.Auth
+	username := auth.Username
+	if username == "" {
+		username = "git"
+	}
+	if auth.SSHKey.isSet() {
+		key, err := auth.SSHKey.get()
+		if err != nil {
+			return nil, err
+		}
+		keyPassword, err := auth.SSHKeyPassword.get()
+		if err != nil {
+			return nil, err
+		}
+		publicKeys, err := gitssh.NewPublicKeys(username, []byte(key), keyPassword)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ssh key: %s", err)
+		}
+		// Default known hosts files are used if none is specified
+		knownHosts := make([]string, 0)
+		if auth.KnownHosts != "" {
+			knownHosts = append(knownHosts, auth.KnownHosts)
+		}
+		hostKeyCallback, err := gitssh.NewKnownHostsCallback(knownHosts...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load known hosts: %s", err)
+		}
+		publicKeys.HostKeyCallback = hostKeyCallback
+		return publicKeys, nil
+	}
+	if auth.Token.isSet() {
+		token, err := auth.Token.get()
+		if err != nil {
+			return nil, err
+		}
+		return &githttp.BasicAuth{Username: username, Password: token}, nil
+	}
+	if auth.Password.isSet() {
+		password, err := auth.Password.get()
+		if err != nil {
+			return nil, err
+		}
+		return &githttp.BasicAuth{Username: username, Password: password}, nil
+	}
+	return nil, nil
+}
+
+// openRepository opens git checkout of source, cloning it if needed
+func openRepository(source Source) (*git.Repository, error) {
+	gitDir := source.Dir
+	if _, ok := os.Stat(gitDir); ok != nil {
+		auth, err := authMethod(source)
+		if err != nil {
+			return nil, err
+		}
+		repo, err := git.PlainClone(gitDir, false, &git.CloneOptions{
+			URL:      source.Git,
+			Auth:     auth,
+			Progress: os.Stdout,
+		})
+		if err != nil {
+			log.Error().Msgf("Git clone error: %s", err)
+			return nil, err
+		}
+		return repo, nil
+	}
+	return git.PlainOpen(gitDir)
+}
+
+// resolveRef returns the commit of ref, a remote branch, a tag or a commit sha
+func resolveRef(repo *git.Repository, ref string) (*plumbing.Hash, error) {
+	remoteBranch, err := repo.Reference(plumbing.NewRemoteReferenceName("origin", ref), true)
+	if err == nil {
+		hash := remoteBranch.Hash()
+		return &hash, nil
+	}
+	hash, err := repo.ResolveRevision(plumbing.Revision(ref))
+	if err != nil {
+		return nil, fmt.Errorf("ref %s not found: %s", ref, err)
+	}
+	return hash, nil
+}
+
+// defaultBranch returns the branch pointed by HEAD of source remote
+func defaultBranch(repo *git.Repository, auth transport.AuthMethod) (string, error) {
+	remote, err := repo.Remote("origin")
+	if err != nil {
+		return "", err
+	}
+	refs, err := remote.List(&git.ListOptions{Auth: auth})
+	if err != nil {
+		return "", fmt.Errorf("failed to list remote references: %s", err)
+	}
+	for _, ref := range refs {
+		if ref.Name() == plumbing.HEAD && ref.Type() == plumbing.SymbolicReference {
+			return ref.Target().Short(), nil
+		}
+	}
+	return "", fmt.Errorf("remote HEAD not found")
+}
+
+// checkoutBranch checks out local branch, created if needed, and hard resets it to hash
+//
+// Checking out the branch, rather than the commit, leaves a checkout previously
+// detached on a pinned ref back on its branch
+func checkoutBranch(repo *git.Repository, workTree *git.Worktree, branch string, hash plumbing.Hash) error {
+	branchRef := plumbing.NewBranchReferenceName(branch)
+	options := git.CheckoutOptions{Branch: branchRef, Force: true}
+	if _, refErr := repo.Reference(branchRef, false); refErr != nil {
+		options.Create = true
+		options.Hash = hash
+	}
+	checkoutErr := workTree.Checkout(&options)
+	if checkoutErr != nil {
+		return fmt.Errorf("failed to checkout branch %s: %s", branch, checkoutErr)
+	}
+	if resetErr := workTree.Reset(&git.ResetOptions{Commit: hash, Mode: git.HardReset}); resetErr != nil {
+		return fmt.Errorf("failed to reset branch %s: %s", branch, resetErr)
+	}
+	return nil
+}
+
+// updateRepository updates checkout to latest commit of source ref, or of remote default branch if ref is empty
+//
+// It returns the commit of checkout
+func updateRepository(repo *git.Repository, source Source) (string, error) {
+	ref := source.Ref
+	workTree, err := repo.Worktree()
+	if err != nil {
+		return "", err
+	}
+	branch := ""
+	if os.Getenv("GOT_PULL_SKIP") != "1" {
+		auth, authErr := authMethod(source)
+		if authErr != nil {
+			return "", authErr
+		}
+		log.Info().Str("ref", ref).Msg("git fetch")
+		fetchErr := repo.Fetch(&git.FetchOptions{
+			Auth: auth,
+			RefSpecs: []gitConfig.RefSpec{
+				"+refs/heads/*:refs/remotes/origin/*",
+				"+refs/tags/*:refs/tags/*",
+			},
+			Tags: git.AllTags,
+		})
+		if fetchErr != nil && fetchErr != git.NoErrAlreadyUpToDate {
+			log.Error().Msgf("Git fetch error: %s", fetchErr)
+			return "", fetchErr
+		}
+		if ref == "" {
+			// Previous pass may have left checkout detached on a pinned ref, pull would fail
+			defaultRef, branchErr := defaultBranch(repo, auth)
+			if branchErr != nil {
+				return "", branchErr
+			}
+			ref = defaultRef
+			branch = defaultRef
+		}
+	}
+	if ref != "" {
+		hash, resolveErr := resolveRef(repo, ref)
+		if resolveErr != nil {
+			return "", resolveErr
+		}
+		if branch != "" {
+			if checkoutErr := checkoutBranch(repo, workTree, branch, *hash); checkoutErr != nil {
+				return "", checkoutErr
+			}
+		} else {
+			checkoutErr := workTree.Checkout(&git.CheckoutOptions{
+				Hash:  *hash,
+				Force: true,
+			})
+			if checkoutErr != nil {
+				return "", fmt.Errorf("failed to checkout %s: %s", ref, checkoutErr)
+			}
+		}
+	}
+	head, err := repo.Head()
+	if err != nil {
+		return "", err
+	}
+	return head.Hash().String(), nil
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+)
+
+// testRepo is a git repository of a test catalog
+type testRepo struct {
+	t    *testing.T
+	dir  string
+	repo *git.Repository
+}
+
+func newTestRepo(t *testing.T) *testRepo {
+	dir, err := ioutil.TempDir("", "goterra-injector")
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo, err := git.PlainInit(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testRepo{t: t, dir: dir, repo: repo}
+}
+
+// commit writes files (removed if content is empty) and commits them, it returns the commit hash
+func (r *testRepo) commit(files map[string]string) string {
+	wt, err := r.repo.Worktree()
+	if err != nil {
+		r.t.Fatal(err)
+	}
+	for file, content := range files {
+		if content == "" {
+			if _, err := wt.Remove(file); err != nil {
+				r.t.Fatal(err)
+			}
+			continue
+		}
+		path := filepath.Join(r.dir, file)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			r.t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			r.t.Fatal(err)
+		}
+		if _, err := wt.Add(file); err != nil {
+			r.t.Fatal(err)
+		}
+	}
+	hash, err := wt.Commit("test", &git.CommitOptions{Author: &object.Signature{Name: "test", Email: "test@example.org", When: time.Now()}})
+	if err != nil {
+		r.t.Fatal(err)
+	}
+	return hash.String()
+}
+
+func TestUpdateRepository(t *testing.T) {
+	upstream := newTestRepo(t)
+	defer os.RemoveAll(upstream.dir)
+	first := upstream.commit(map[string]string{"README.md": "v1\n"})
+	if _, err := upstream.repo.CreateTag("v1.0", plumbing.NewHash(first), nil); err != nil {
+		t.Fatal(err)
+	}
+	second := upstream.commit(map[string]string{"README.md": "v2\n"})
+
+	checkout := newTestRepo(t)
+	os.RemoveAll(checkout.dir)
+	defer os.RemoveAll(checkout.dir)
+	defer os.Setenv("GOT_PULL_SKIP", os.Getenv("GOT_PULL_SKIP"))
+	os.Unsetenv("GOT_PULL_SKIP")
+	source := Source{Name: "test", Git: upstream.dir, Dir: checkout.dir}
+	repo, err := openRepository(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Pinned ref leaves checkout detached
+	source.Ref = "v1.0"
+	if commit, err := updateRepository(repo, source); err != nil || commit != first {
+		t.Fatalf("pinned update = %s, %v, want %s", commit, err, first)
+	}
+
+	// Clearing ref goes back to latest commit of default branch
+	third := upstream.commit(map[string]string{"README.md": "v3\n"})
+	source.Ref = ""
+	commit, err := updateRepository(repo, source)
+	if err != nil || commit != third {
+		t.Fatalf("default branch update = %s, %v, want %s (previous %s)", commit, err, third, second)
+	}
+	head, err := repo.Head()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if head.Name() != plumbing.Master {
+		t.Errorf("checkout is on %s, want %s", head.Name(), plumbing.Master)
+	}
+
+	// Next pass follows the branch
+	fourth := upstream.commit(map[string]string{"README.md": "v4\n"})
+	if commit, err := updateRepository(repo, source); err != nil || commit != fourth {
+		t.Errorf("second default branch update = %s, %v, want %s", commit, err, fourth)
+	}
+	if commit, err := updateRepository(repo, source); err != nil || commit != fourth {
+		t.Errorf("up to date update = %s, %v, want %s", commit, err, fourth)
+	}
+}
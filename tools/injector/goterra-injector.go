@@ -3,12 +3,11 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"flag"
 	"fmt"
-	"io/ioutil"
 	"net/http"
 	"os"
 	"path/filepath"
-	"strings"
 	"time"
 
 	"github.com/gorilla/handlers"
@@ -23,9 +22,6 @@ import (
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 
-	"gopkg.in/src-d/go-git.v4"
-	yaml "gopkg.in/yaml.v2"
-
 	terraGitModel "github.com/osallou/goterra-community/tools/model"
 	terraModel "github.com/osallou/goterra-lib/lib/model"
 )
@@ -39,19 +35,9 @@ var recipeCollection *mongo.Collection
 var templateCollection *mongo.Collection
 var endpointCollection *mongo.Collection
 var appCollection *mongo.Collection
+var injectorCollection *mongo.Collection
 
-func pull(workTree *git.Worktree) error {
-	pullOptions := git.PullOptions{}
-	log.Info().Msg("git pull")
-	err := workTree.Pull(&pullOptions)
-	if err != nil {
-		if err != git.NoErrAlreadyUpToDate {
-			log.Error().Msgf("Git pull error: %s", err)
-			return err
-		}
-	}
-	return nil
-}
+var injectorConfig InjectorConfig
 
 func findFiles(targetDir string, pattern string) (files []string, err error) {
 	files = make([]string, 0)
@@ -67,22 +53,34 @@ func findFiles(targetDir string, pattern string) (files []string, err error) {
 	return files, nil
 }
 
-// getNS returns namespace id, creates it if not present
-func getNS() (string, error) {
+// findNS returns id of namespace name
+func findNS(name string) (string, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
 	var nsdb terraModel.NSData
 	req := bson.M{
-		"name": "goterra",
+		"name": name,
 	}
 	err := nsCollection.FindOne(ctx, req).Decode(&nsdb)
+	if err != nil {
+		return "", err
+	}
+	return nsdb.ID.Hex(), nil
+}
+
+// getNS returns id of namespace name, creates it with owners and members if not present
+func getNS(name string, owners []string, members []string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	nsID, err := findNS(name)
 	if err != nil {
 		// Create it
 		ns := bson.M{
-			"name":    "goterra",
-			"owners":  make([]string, 0),
-			"members": make([]string, 0),
+			"name":    name,
+			"owners":  owners,
+			"members": members,
 		}
 		newns, err := nsCollection.InsertOne(ctx, ns)
 		if err != nil {
@@ -91,14 +89,14 @@ func getNS() (string, error) {
 		}
 		return newns.InsertedID.(primitive.ObjectID).Hex(), nil
 	}
-	return nsdb.ID.Hex(), nil
+	return nsID, nil
 }
 
-func getRecipe(ns string, name string, version string) (*terraModel.Recipe, error) {
+func getRecipe(ns string, name string, version string) (*terraModel.Recipe, injectionMeta, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
-	var recipe terraModel.Recipe
+	var recipe recipeDocument
 	req := bson.M{
 		"namespace":     ns,
 		"remote":        name,
@@ -108,27 +106,28 @@ func getRecipe(ns string, name string, version string) (*terraModel.Recipe, erro
 	err := recipeCollection.FindOne(ctx, req).Decode(&recipe)
 	if err != nil {
 		log.Info().Msgf("error => %s", err)
-		return nil, err
+		return nil, injectionMeta{}, err
 	}
-	return &recipe, nil
+	return &recipe.Recipe, recipe.Meta, nil
 }
 
-func updateRecipe(ns string, recipe *terraModel.Recipe) {
+func updateRecipe(ns string, recipe *terraModel.Recipe, meta injectionMeta) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 	req := bson.M{
 		"_id": recipe.ID,
 	}
-	_, err := recipeCollection.ReplaceOne(ctx, req, recipe)
+	_, err := recipeCollection.ReplaceOne(ctx, req, recipeDocument{*recipe, meta})
 	if err != nil {
 		log.Error().Msgf("Failed to update recipe %s", err)
 	}
+	return err
 }
 
-func createRecipe(ns string, recipe *terraModel.Recipe) (string, error) {
+func createRecipe(ns string, recipe *terraModel.Recipe, meta injectionMeta) (string, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
-	newRecipe, err := recipeCollection.InsertOne(ctx, recipe)
+	newRecipe, err := recipeCollection.InsertOne(ctx, recipeDocument{*recipe, meta})
 	if err != nil {
 		log.Error().Msgf("Failed to create recipe %+v", recipe)
 		return "", err
@@ -136,11 +135,11 @@ func createRecipe(ns string, recipe *terraModel.Recipe) (string, error) {
 	return newRecipe.InsertedID.(primitive.ObjectID).Hex(), nil
 }
 
-func getTemplate(ns string, name string, version string) (*terraModel.Template, error) {
+func getTemplate(ns string, name string, version string) (*terraModel.Template, injectionMeta, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
-	var template terraModel.Template
+	var template templateDocument
 	req := bson.M{
 		"namespace":     ns,
 		"remote":        name,
@@ -150,27 +149,28 @@ func getTemplate(ns string, name string, version string) (*terraModel.Template,
 	err := templateCollection.FindOne(ctx, req).Decode(&template)
 	if err != nil {
 		log.Info().Msgf("error => %s", err)
-		return nil, err
+		return nil, injectionMeta{}, err
 	}
-	return &template, nil
+	return &template.Template, template.Meta, nil
 }
 
-func updateTemplate(ns string, template *terraModel.Template) {
+func updateTemplate(ns string, template *terraModel.Template, meta injectionMeta) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 	req := bson.M{
 		"_id": template.ID,
 	}
-	_, err := templateCollection.ReplaceOne(ctx, req, template)
+	_, err := templateCollection.ReplaceOne(ctx, req, templateDocument{*template, meta})
 	if err != nil {
 		log.Error().Msgf("Failed to update template %s", err)
 	}
+	return err
 }
 
-func createTemplate(ns string, template *terraModel.Template) (string, error) {
+func createTemplate(ns string, template *terraModel.Template, meta injectionMeta) (string, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
-	newTemplate, err := templateCollection.InsertOne(ctx, template)
+	newTemplate, err := templateCollection.InsertOne(ctx, templateDocument{*template, meta})
 	if err != nil {
 		log.Error().Msgf("Failed to create template %+v", template)
 		return "", err
@@ -178,11 +178,11 @@ func createTemplate(ns string, template *terraModel.Template) (string, error) {
 	return newTemplate.InsertedID.(primitive.ObjectID).Hex(), nil
 }
 
-func getEndpoint(ns string, name string) (*terraModel.EndPoint, error) {
+func getEndpoint(ns string, name string) (*terraModel.EndPoint, injectionMeta, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
-	var endpoint terraModel.EndPoint
+	var endpoint endpointDocument
 	req := bson.M{
 		"namespace": ns,
 		"remote":    name,
@@ -191,27 +191,28 @@ func getEndpoint(ns string, name string) (*terraModel.EndPoint, error) {
 	err := endpointCollection.FindOne(ctx, req).Decode(&endpoint)
 	if err != nil {
 		log.Info().Msgf("error => %s", err)
-		return nil, err
+		return nil, injectionMeta{}, err
 	}
-	return &endpoint, nil
+	return &endpoint.EndPoint, endpoint.Meta, nil
 }
 
-func updateEndpoint(ns string, endpoint *terraModel.EndPoint) {
+func updateEndpoint(ns string, endpoint *terraModel.EndPoint, meta injectionMeta) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 	req := bson.M{
 		"_id": endpoint.ID,
 	}
-	_, err := endpointCollection.ReplaceOne(ctx, req, endpoint)
+	_, err := endpointCollection.ReplaceOne(ctx, req, endpointDocument{*endpoint, meta})
 	if err != nil {
 		log.Error().Msgf("Failed to update endpoint %s", err)
 	}
+	return err
 }
 
-func createEndpoint(ns string, endpoint *terraModel.EndPoint) (string, error) {
+func createEndpoint(ns string, endpoint *terraModel.EndPoint, meta injectionMeta) (string, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
-	newEndpoint, err := endpointCollection.InsertOne(ctx, endpoint)
+	newEndpoint, err := endpointCollection.InsertOne(ctx, endpointDocument{*endpoint, meta})
 	if err != nil {
 		log.Error().Msgf("Failed to create endpoint %+v", endpoint)
 		return "", err
@@ -219,11 +220,11 @@ func createEndpoint(ns string, endpoint *terraModel.EndPoint) (string, error) {
 	return newEndpoint.InsertedID.(primitive.ObjectID).Hex(), nil
 }
 
-func getApplication(ns string, name string, version string) (*terraModel.Application, error) {
+func getApplication(ns string, name string, version string) (*terraModel.Application, injectionMeta, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
-	var application terraModel.Application
+	var application applicationDocument
 	req := bson.M{
 		"namespace":     ns,
 		"remote":        name,
@@ -233,27 +234,28 @@ func getApplication(ns string, name string, version string) (*terraModel.Applica
 	err := appCollection.FindOne(ctx, req).Decode(&application)
 	if err != nil {
 		log.Info().Msgf("error => %s", err)
-		return nil, err
+		return nil, injectionMeta{}, err
 	}
-	return &application, nil
+	return &application.Application, application.Meta, nil
 }
 
-func updateApplication(ns string, application *terraModel.Application) {
+func updateApplication(ns string, application *terraModel.Application, meta injectionMeta) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 	req := bson.M{
 		"_id": application.ID,
 	}
-	_, err := appCollection.ReplaceOne(ctx, req, application)
+	_, err := appCollection.ReplaceOne(ctx, req, applicationDocument{*application, meta})
 	if err != nil {
 		log.Error().Msgf("Failed to update application %s", err)
 	}
+	return err
 }
 
-func createApplication(ns string, application *terraModel.Application) (string, error) {
+func createApplication(ns string, application *terraModel.Application, meta injectionMeta) (string, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
-	newApplication, err := appCollection.InsertOne(ctx, application)
+	newApplication, err := appCollection.InsertOne(ctx, applicationDocument{*application, meta})
 	if err != nil {
 		log.Error().Msgf("Failed to create application %+v", application)
 		return "", err
@@ -261,466 +263,61 @@ func createApplication(ns string, application *terraModel.Application) (string,
 	return newApplication.InsertedID.(primitive.ObjectID).Hex(), nil
 }
 
-func injector() {
-	config := terraConfig.LoadConfig()
-	gitDir := "/tmp/goterra-git"
-	var repo *git.Repository
-	var err error
-
-	if _, ok := os.Stat(gitDir); ok != nil {
-		repo, err = git.PlainClone(gitDir, false, &git.CloneOptions{
-			URL:      config.Git,
-			Progress: os.Stdout,
-		})
-		if err != nil {
-			log.Error().Msgf("Git clone error: %s", err)
-			if err != git.ErrRepositoryAlreadyExists {
-				os.Exit(1)
-			}
-		}
-	} else {
-		repo, err = git.PlainOpen(gitDir)
-		if err != nil {
-			os.Exit(1)
-		}
+// injector syncs source in a loop, waiting for an hour or a hook between passes
+func injector(source Source, defaultImage string) {
+	repo, err := openRepository(source)
+	if err != nil {
+		log.Error().Str("source", source.Name).Msgf("Failed to open repository: %s", err)
+		os.Exit(1)
 	}
 
-	workTree, _ := repo.Worktree()
-
-	ns, nserr := getNS()
+	ns, nserr := getNS(source.Namespace, source.Owners, source.Members)
 	if nserr != nil {
 		os.Exit(1)
 	}
 
 	for true {
-		log.Info().Msg("Try to inject new/updated recipes")
-
-		createdRecipes := make(map[string]string)
-		foundRecipes := make(map[string]terraModel.Recipe)
-		createdTemplates := make(map[string]string)
-
-		if os.Getenv("GOT_PULL_SKIP") != "1" {
-			pullErr := pull(workTree)
-			if pullErr != nil {
-				log.Error().Msgf("Failed to pull files")
-				time.Sleep(10 * time.Minute)
-				continue
-			}
-		}
-		files, err := findFiles(gitDir+"/recipes", "recipe.yaml")
-		if err != nil {
-			log.Error().Msgf("failed to search recipes: %s", err)
-			time.Sleep(10 * time.Minute)
+		log.Info().Str("source", source.Name).Msg("Try to inject new/updated recipes")
+		run := newRun(source)
+
+		commit, updateErr := updateRepository(repo, source)
+		if updateErr != nil {
+			log.Error().Str("source", source.Name).Msgf("Failed to update files")
+			run.finish(fmt.Errorf("failed to update files: %s", updateErr))
+			waitSync(source.Name, 10*time.Minute)
 			continue
 		}
-		for _, file := range files {
-			yamlRecipe, _ := ioutil.ReadFile(file)
-			t := terraGitModel.RecipeDefinition{}
-			t.Recipe.Path = file
-			err := yaml.Unmarshal(yamlRecipe, &t)
-			if err != nil {
-				log.Error().Msgf("Failed to read %s", file)
-				continue
-			}
-			errCheck := t.Recipe.Check()
-			if errCheck != nil {
-				log.Error().Msgf("Recipe did not pass the check!  %s", t.Recipe.Path)
-				continue
-			}
-			elts := strings.Split(t.Recipe.Path, "/")
-			name := elts[len(elts)-3]
-			version := elts[len(elts)-2]
-			recipe, rerr := getRecipe(ns, name, version)
-			if rerr == nil && recipe.Frozen {
-				log.Error().Str("recipe", name).Str("version", version).Msg("Recipe is frozen, cannot update")
-				continue
-			}
-			if rerr != nil {
-				// Does not exists
-				log.Debug().Msgf("Recipe does not exists %s:%s", name, version)
-				recipe = &terraModel.Recipe{}
-				recipe.Name = t.Recipe.Name
-				recipe.BaseImages = t.Recipe.Base
-				recipe.Tags = t.Recipe.Tags
-				recipe.Timestamp = time.Now().Unix()
-				recipe.Inputs = t.Recipe.Inputs
-				recipe.Namespace = ns
-				recipe.Description = t.Recipe.Description
-				recipe.Public = true
-				script, scriptErr := ioutil.ReadFile(fmt.Sprintf("%s/recipes/%s/%s/recipe.sh", gitDir, name, version))
-				recipe.Remote = name
-				recipe.RemoteVersion = version
-				recipe.Version = version
-				if scriptErr != nil {
-					log.Warn().Msgf("Could not read recipe script %s", t.Recipe.Path)
-					continue
-				}
-				recipe.Defaults = t.Recipe.Defaults
-				recipe.Script = string(script)
-				recipe.ParentRecipe = ""
-				if t.Recipe.Parent != "" {
-					elts := strings.Split(t.Recipe.Parent, "/")
-					if len(elts) != 2 {
-						log.Error().Msgf("Invalid parent")
-						continue
-					}
-					parentInDB, parentErr := getRecipe(ns, elts[0], elts[1])
-					if parentErr != nil {
-						log.Error().Msgf("could not find parent in db for %s, skipping... may be an ordering issue", t.Recipe.Path)
-						continue
-					}
-					recipe.ParentRecipe = parentInDB.ID.Hex()
-				}
-				id, newErr := createRecipe(ns, recipe)
-				if newErr == nil {
-					createdRecipes[name+"/"+version] = id
-				}
-			} else {
-				// Exists
-				log.Debug().Msgf("Recipe exists %s:%s", name, version)
-				recipe.Name = t.Recipe.Name
-				recipe.BaseImages = t.Recipe.Base
-				recipe.Tags = t.Recipe.Tags
-				recipe.Timestamp = time.Now().Unix()
-				recipe.Inputs = t.Recipe.Inputs
-				recipe.Namespace = ns
-				recipe.Description = t.Recipe.Description
-				recipe.Public = true
-				recipe.Version = version
-				script, scriptErr := ioutil.ReadFile(fmt.Sprintf("%s/recipes/%s/%s/recipe.sh", gitDir, name, version))
-				if scriptErr != nil {
-					log.Error().Msgf("Could not read recipe script %s", t.Recipe.Path)
-					continue
-				}
-				recipe.Defaults = t.Recipe.Defaults
-				recipe.Script = string(script)
-				recipe.ParentRecipe = ""
-				if t.Recipe.Parent != "" {
-					elts := strings.Split(t.Recipe.Parent, "/")
-					if len(elts) != 2 {
-						log.Error().Msgf("Invalid parent")
-						continue
-					}
-					parentInDB, parentErr := getRecipe(ns, elts[0], elts[1])
-					if parentErr != nil {
-						log.Error().Msgf("could not find parent in db for %s, skipping... may be an ordering issue", t.Recipe.Path)
-						continue
-					}
-					recipe.ParentRecipe = parentInDB.ID.Hex()
-				}
-				updateRecipe(ns, recipe)
-				createdRecipes[name+"/"+version] = recipe.ID.Hex()
-			}
-			tmpRecipe := terraModel.Recipe{
-				Remote:        name,
-				RemoteVersion: version,
-				BaseImages:    t.Recipe.Base,
-				ParentRecipe:  t.Recipe.Parent,
-			}
-			foundRecipes[fmt.Sprintf("%s/%s", name, version)] = tmpRecipe
-
-		}
-
-		files, err = findFiles(gitDir+"/templates", "template.yaml")
-		if err != nil {
-			log.Error().Msgf("failed to search templates: %s", err)
-		}
-		for _, file := range files {
-			yamlTemplate, _ := ioutil.ReadFile(file)
-			t := terraGitModel.TemplateDefinition{}
-			t.Template.Path = file
-			err := yaml.Unmarshal(yamlTemplate, &t)
-			if err != nil {
-				log.Error().Msgf("Failed to read %s", file)
-				continue
-			}
-			errCheck := t.Template.Check()
-			if errCheck != nil {
-				log.Error().Msgf("Template did not pass the check!  %s", t.Template.Path)
-				continue
-			}
-
-			elts := strings.Split(t.Template.Path, "/")
-			name := elts[len(elts)-3]
-			version := elts[len(elts)-2]
-			template, rerr := getTemplate(ns, name, version)
-			if rerr == nil && template.Frozen {
-				log.Error().Str("template", name).Str("version", version).Msg("Template is frozen, cannot update")
-				continue
-			}
-			if rerr != nil {
-				// Does not exists
-				log.Debug().Msgf("Template does not exists %s:%s", name, version)
-				template = &terraModel.Template{}
-				template.Name = t.Template.Name
-				template.Tags = t.Template.Tags
-				template.Timestamp = time.Now().Unix()
-				template.Inputs = t.Template.Inputs
-				template.Namespace = ns
-				template.Description = t.Template.Description
-				template.Public = true
-				template.Remote = name
-				template.RemoteVersion = version
-				template.Version = version
-				template.Defaults = t.Template.Defaults
-				template.Data = make(map[string]string)
-				for cloud, file := range t.Template.Files {
-					scriptFile := fmt.Sprintf("%s/templates/%s/%s/%s/%s", gitDir, name, version, cloud, file)
-					script, scriptErr := ioutil.ReadFile(scriptFile)
-					if scriptErr != nil {
-						log.Error().Msgf("Could not read template script %s: %s", t.Template.Path, scriptFile)
-						continue
-					}
-					template.Data[cloud] = string(script)
-				}
-				if t.Template.Recipes == nil {
-					t.Template.Recipes = make([]string, 0)
-				}
-				template.VarRecipes = t.Template.Recipes
-				id, newErr := createTemplate(ns, template)
-				if newErr == nil {
-					createdRecipes[name+"/"+version] = id
-				}
-			} else {
-				// Exists
-				log.Debug().Msgf("Template exists %s:%s", name, version)
-				template.Name = t.Template.Name
-				template.Tags = t.Template.Tags
-				template.Timestamp = time.Now().Unix()
-				template.Inputs = t.Template.Inputs
-				template.Namespace = ns
-				template.Description = t.Template.Description
-				template.Public = true
-				template.Version = version
-				template.Defaults = t.Template.Defaults
-				template.Data = make(map[string]string)
-				for cloud, file := range t.Template.Files {
-					scriptFile := fmt.Sprintf("%s/templates/%s/%s/%s/%s", gitDir, name, version, cloud, file)
-					script, scriptErr := ioutil.ReadFile(scriptFile)
-					if scriptErr != nil {
-						log.Error().Msgf("Could not read template script %s: %s", t.Template.Path, scriptFile)
-						continue
-					}
-					template.Data[cloud] = string(script)
-				}
-				if t.Template.Recipes == nil {
-					t.Template.Recipes = make([]string, 0)
-				}
-				template.VarRecipes = t.Template.Recipes
-				updateTemplate(ns, template)
-				createdTemplates[name+"/"+version] = template.ID.Hex()
-			}
-
-		}
-
-		files, err = findFiles(gitDir+"/endpoints", "endpoint.yaml")
-		if err != nil {
-			log.Error().Msgf("failed to search endpoints: %s", err)
+		run.setCommit(commit)
+
+		state := getSyncState(source.Name)
+		changes := passChanges(repo, state, commit)
+		if changes.full() {
+			log.Info().Str("source", source.Name).Msg("Full sync")
+		} else {
+			log.Info().Str("source", source.Name).Msgf("Incremental sync from %s", state.Commit)
 		}
-		for _, file := range files {
-			yamlEndpoint, _ := ioutil.ReadFile(file)
-			t := terraGitModel.EndpointDefinition{}
-			t.Endpoint.Path = file
-			err := yaml.Unmarshal(yamlEndpoint, &t)
-			if err != nil {
-				log.Error().Msgf("Failed to read %s", file)
-				continue
-			}
-			errCheck := t.Endpoint.Check()
-			if errCheck != nil {
-				log.Error().Msgf("Endpoint did not pass the check!  %s", t.Endpoint.Path)
-				continue
-			}
-
-			elts := strings.Split(t.Endpoint.Path, "/")
-			name := elts[len(elts)-2]
-			endpoint, rerr := getEndpoint(ns, name)
-			if rerr != nil {
-				// Does not exists
-				log.Debug().Msgf("Endpoint does not exists %s", name)
-				endpoint = &terraModel.EndPoint{}
-				endpoint.Name = t.Endpoint.Name
-				endpoint.Remote = name
-				endpoint.Timestamp = time.Now().Unix()
-				endpoint.Namespace = ns
-				endpoint.Public = true
-				endpoint.Kind = t.Endpoint.Kind
-				endpoint.Defaults = t.Endpoint.Defaults
-				endpoint.Features = t.Endpoint.Features
-				if endpoint.Features == nil {
-					endpoint.Features = make(map[string]string)
-				}
-				endpoint.Inputs = t.Endpoint.Inputs
-				if endpoint.Inputs == nil {
-					endpoint.Inputs = make(map[string]string)
-				}
-
-				endpoint.Config = t.Endpoint.Config
-				if endpoint.Config == nil {
-					endpoint.Config = make(map[string]string)
-				}
-
-				endpoint.Images = t.Endpoint.Images
-				if endpoint.Images == nil {
-					endpoint.Images = make(map[string]string)
-				}
-
-				createEndpoint(ns, endpoint)
-			} else {
-				// Exists
-				log.Debug().Msgf("Endpoint exists %s", name)
-				endpoint.Name = t.Endpoint.Name
-				endpoint.Remote = name
-				endpoint.Timestamp = time.Now().Unix()
-				endpoint.Namespace = ns
-				endpoint.Public = true
-				endpoint.Kind = t.Endpoint.Kind
-				endpoint.Defaults = t.Endpoint.Defaults
-				endpoint.Features = t.Endpoint.Features
-				if endpoint.Features == nil {
-					endpoint.Features = make(map[string]string)
-				}
-				endpoint.Inputs = t.Endpoint.Inputs
-				if endpoint.Inputs == nil {
-					endpoint.Inputs = make(map[string]string)
-				}
-
-				endpoint.Config = t.Endpoint.Config
-				if endpoint.Config == nil {
-					endpoint.Config = make(map[string]string)
-				}
-
-				endpoint.Images = t.Endpoint.Images
-				if endpoint.Images == nil {
-					endpoint.Images = make(map[string]string)
-				}
-				updateEndpoint(ns, endpoint)
-			}
-
+		items := newCatalog(state.Catalog)
+		found, syncErr := syncPass(ns, source.Dir, defaultImage, changes, items, run)
+		if syncErr != nil {
+			run.finish(syncErr)
+			waitSync(source.Name, 10*time.Minute)
+			continue
 		}
 
-		files, err = findFiles(gitDir+"/apps", "app.yaml")
-		if err != nil {
-			log.Error().Msgf("failed to search apps: %s", err)
+		if pruneErr := prune(ns, injectorConfig.Prune, found, nil); pruneErr != nil {
+			log.Error().Str("source", source.Name).Msgf("Failed to prune removed items: %s", pruneErr)
 		}
-		for _, file := range files {
-			yamlApp, _ := ioutil.ReadFile(file)
-			t := terraGitModel.ApplicationDefinition{}
-			t.Application.Path = file
-			err := yaml.Unmarshal(yamlApp, &t)
-			if err != nil {
-				log.Error().Msgf("Failed to read %s", file)
-				continue
-			}
-
-			expectedRecipes, errCheck := t.Application.Check()
-			if errCheck != nil {
-				log.Error().Msgf("Application did not pass the check!  %s", t.Application.Path)
-				continue
-			}
-			appRecipes := make([]terraModel.Recipe, 0)
-			for _, expectedRecipe := range expectedRecipes {
-				appRecipes = append(appRecipes, foundRecipes[expectedRecipe])
-			}
-
-			var baseImages []string
-			var baseErr error
-			if len(t.Application.Recipes) == 0 && config.DefaultImage != "" {
-				baseImages = make([]string, 1)
-				baseImages[0] = config.DefaultImage
-			} else {
-				baseImages, baseErr = t.Application.GetAppBaseImages(appRecipes, foundRecipes)
-				if baseErr != nil {
-					log.Error().Msgf("Application %s could not find a base image between recipes", t.Application.Path)
-					continue
-				}
-			}
-			log.Error().Msgf("Base images: %+v", baseImages)
-
-			elts := strings.Split(t.Application.Path, "/")
-			name := elts[len(elts)-3]
-			version := elts[len(elts)-2]
-			application, rerr := getApplication(ns, name, version)
-			if rerr == nil && application.Frozen {
-				log.Error().Str("application", name).Str("version", version).Msg("App is frozen, cannot update")
-				continue
-			}
-			if rerr != nil {
-				// Does not exists
-				log.Debug().Msgf("Application does not exists %s", name)
-				application = &terraModel.Application{}
-				application.Image = baseImages
-				application.Name = t.Application.Name
-				application.Description = t.Application.Description
-				application.Remote = name
-				application.RemoteVersion = version
-				application.Version = version
-				application.Timestamp = time.Now().Unix()
-				application.Namespace = ns
-				application.Public = true
-				application.Defaults = t.Application.Defaults
-				application.Template = createdTemplates[t.Application.Template]
-				application.TemplateRecipes = make(map[string][]string)
-				hasError := false
-				for tplVar, recipes := range t.Application.Recipes {
-					for _, recipe := range recipes {
-						if recipeID, ok := createdRecipes[recipe]; ok {
-							if application.TemplateRecipes[tplVar] == nil {
-								application.TemplateRecipes[tplVar] = make([]string, 0)
-							}
-							application.TemplateRecipes[tplVar] = append(application.TemplateRecipes[tplVar], recipeID)
-						} else {
-							log.Error().Msgf("App %s requests recipe %s, but it does not exists!", t.Application.Name, recipe)
-							hasError = true
-							break
-						}
-
-					}
-				}
-				if hasError {
-					continue
-				}
-
-				createApplication(ns, application)
-			} else {
-				// Exists
-				log.Debug().Msgf("Application exists %s", name)
-				application.Name = t.Application.Name
-				application.Image = baseImages
-				application.Description = t.Application.Description
-				application.Version = version
-				application.Timestamp = time.Now().Unix()
-				application.Namespace = ns
-				application.Public = true
-				application.Defaults = t.Application.Defaults
-				application.Template = createdTemplates[t.Application.Template]
-				application.TemplateRecipes = make(map[string][]string)
-				hasError := false
-				for tplVar, recipes := range t.Application.Recipes {
-					for _, recipe := range recipes {
-						if recipeID, ok := createdRecipes[recipe]; ok {
-							if application.TemplateRecipes[tplVar] == nil {
-								application.TemplateRecipes[tplVar] = make([]string, 0)
-							}
-							application.TemplateRecipes[tplVar] = append(application.TemplateRecipes[tplVar], recipeID)
-						} else {
-							log.Error().Msgf("App %s requests recipe %s, but it does not exists!", t.Application.Name, recipe)
-							hasError = true
-							break
-						}
-
-					}
-				}
-				if hasError {
-					continue
-				}
-				updateApplication(ns, application)
-			}
-
+		state.Commit = commit
+		state.Failed = run.failedFiles(source.Dir)
+		state.Catalog = items.nodes()
+		if changes.full() {
+			state.Full = time.Now().Unix()
 		}
+		saveSyncState(state)
+		run.finish(nil)
 
-		// Sleep for one hour
-		time.Sleep(1 * time.Hour)
+		// Sleep for one hour, or until a hook is received
+		waitSync(source.Name, 1*time.Hour)
 	}
 
 }
@@ -732,6 +329,30 @@ var HomeHandler = func(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(resp)
 }
 
+// connectMongo connects to mongo and sets collections, exits on failure
+func connectMongo(mongoURL string, mongoDB string) {
+	mongoClient, err := mongo.NewClient(mongoOptions.Client().ApplyURI(mongoURL))
+	if err != nil {
+		log.Error().Msgf("Failed to connect to mongo server %s", mongoURL)
+		os.Exit(1)
+	}
+	ctx, cancelMongo := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancelMongo()
+
+	err = mongoClient.Connect(ctx)
+	if err != nil {
+		log.Error().Msgf("Failed to connect to mongo server %s", mongoURL)
+		os.Exit(1)
+	}
+
+	nsCollection = mongoClient.Database(mongoDB).Collection("ns")
+	recipeCollection = mongoClient.Database(mongoDB).Collection("recipe")
+	templateCollection = mongoClient.Database(mongoDB).Collection("template")
+	endpointCollection = mongoClient.Database(mongoDB).Collection("endpoint")
+	appCollection = mongoClient.Database(mongoDB).Collection("application")
+	injectorCollection = mongoClient.Database(mongoDB).Collection("injector")
+}
+
 func main() {
 
 	zerolog.TimeFieldFormat = zerolog.TimeFormatUnix
@@ -741,7 +362,37 @@ func main() {
 		zerolog.SetGlobalLevel(zerolog.DebugLevel)
 	}
 
+	planMode := flag.Bool("plan", false, "print what injector would do, without writing anything")
+	flag.Parse()
+
 	config := terraConfig.LoadConfig()
+	var configErr error
+	injectorConfig, configErr = loadInjectorConfig(config.Git)
+	if configErr != nil {
+		log.Error().Msgf("Invalid injector config: %s", configErr)
+		os.Exit(1)
+	}
+	if injectorConfig.MaxRecipeDepth != nil {
+		terraGitModel.MaxRecipeDepth = *injectorConfig.MaxRecipeDepth
+	}
+	if os.Getenv("GOT_DRY_RUN") == "1" {
+		*planMode = true
+	}
+
+	if *planMode {
+		connectMongo(config.Mongo.URL, config.Mongo.DB)
+		planFailed := false
+		for _, source := range injectorConfig.Sources {
+			if planErr := planInjection(source, config.DefaultImage); planErr != nil {
+				log.Error().Str("source", source.Name).Msgf("Plan failed: %s", planErr)
+				planFailed = true
+			}
+		}
+		if planFailed {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
 
 	consulErr := terraConfig.ConsulDeclare("got-injector", "/injector")
 	if consulErr != nil {
@@ -749,30 +400,20 @@ func main() {
 		panic(consulErr)
 	}
 
-	mongoClient, err := mongo.NewClient(mongoOptions.Client().ApplyURI(config.Mongo.URL))
-	if err != nil {
-		log.Error().Msgf("Failed to connect to mongo server %s", config.Mongo.URL)
-		os.Exit(1)
-	}
-	ctx, cancelMongo := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancelMongo()
+	connectMongo(config.Mongo.URL, config.Mongo.DB)
 
-	err = mongoClient.Connect(ctx)
-	if err != nil {
-		log.Error().Msgf("Failed to connect to mongo server %s", config.Mongo.URL)
-		os.Exit(1)
+	for _, source := range injectorConfig.Sources {
+		syncTriggers[source.Name] = make(chan bool, 1)
+	}
+	for _, source := range injectorConfig.Sources {
+		go injector(source, config.DefaultImage)
 	}
-
-	nsCollection = mongoClient.Database(config.Mongo.DB).Collection("ns")
-	recipeCollection = mongoClient.Database(config.Mongo.DB).Collection("recipe")
-	templateCollection = mongoClient.Database(config.Mongo.DB).Collection("template")
-	endpointCollection = mongoClient.Database(config.Mongo.DB).Collection("endpoint")
-	appCollection = mongoClient.Database(config.Mongo.DB).Collection("application")
-
-	go injector()
 
 	r := mux.NewRouter()
 	r.HandleFunc("/injector", HomeHandler).Methods("GET")
+	r.HandleFunc("/injector/hook", HookHandler).Methods("POST")
+	r.HandleFunc("/injector/status", StatusHandler).Methods("GET")
+	r.HandleFunc("/injector/runs", RunsHandler).Methods("GET")
 
 	c := cors.New(cors.Options{
 		AllowedOrigins: []string{"*"},
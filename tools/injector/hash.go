@@ -0,0 +1,57 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// documentFormat is part of content hashes, it changes when injector stores new document fields
+// so that unchanged documents are updated once
+const documentFormat = "2"
+
+// contentHash returns the sha256 of files content and of the values a document derives from other documents
+func contentHash(files []string, values ...string) (string, error) {
+	h := sha256.New()
+	fmt.Fprintf(h, "format:%s\n", documentFormat)
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(h, "%s:%d\n", filepath.Base(file), len(data))
+		h.Write(data)
+	}
+	for _, value := range values {
+		fmt.Fprintf(h, "%d:%s\n", len(value), value)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// sortedKeys returns the keys of m in a stable order, for hashes not to depend on map iteration order
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// templateRecipesValues returns the recipes of each template variable as hash values, sorted by variable
+func templateRecipesValues(templateRecipes map[string][]string) []string {
+	tplVars := make([]string, 0, len(templateRecipes))
+	for tplVar := range templateRecipes {
+		tplVars = append(tplVars, tplVar)
+	}
+	sort.Strings(tplVars)
+	values := make([]string, 0, len(tplVars))
+	for _, tplVar := range tplVars {
+		values = append(values, tplVar+"="+strings.Join(templateRecipes[tplVar], ","))
+	}
+	return values
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestContentHash(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goterra-injector")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "recipe.yaml")
+	if err := ioutil.WriteFile(file, []byte("recipe:\n  name: test\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	hash, err := contentHash([]string{file}, "ns", "true")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	same, _ := contentHash([]string{file}, "ns", "true")
+	if hash != same {
+		t.Errorf("hash is not stable: %s != %s", hash, same)
+	}
+	// Values are length prefixed, splitting them differently changes hash
+	split, _ := contentHash([]string{file}, "nst", "rue")
+	if hash == split {
+		t.Errorf("hash does not depend on values boundaries")
+	}
+	if _, err := contentHash([]string{filepath.Join(dir, "missing")}); err == nil {
+		t.Errorf("expected an error for missing file")
+	}
+}
+
+func TestHashValuesMapOrder(t *testing.T) {
+	files := map[string]string{}
+	recipes := map[string][]string{}
+	for _, key := range []string{"openstack", "aws", "azure", "gcp", "vm", "db", "web", "master", "worker"} {
+		files[key] = key + ".tf"
+		recipes[key] = []string{key + "1", key + "2"}
+	}
+	wantKeys := []string{"aws", "azure", "db", "gcp", "master", "openstack", "vm", "web", "worker"}
+	wantValues := []string{"aws=aws1,aws2", "azure=azure1,azure2", "db=db1,db2", "gcp=gcp1,gcp2", "master=master1,master2", "openstack=openstack1,openstack2", "vm=vm1,vm2", "web=web1,web2", "worker=worker1,worker2"}
+
+	wantHash, _ := contentHash(nil, wantValues...)
+
+	// Map iteration order is random, repeat to catch order dependent results
+	for i := 0; i < 20; i++ {
+		if keys := sortedKeys(files); !reflect.DeepEqual(keys, wantKeys) {
+			t.Fatalf("sortedKeys = %v, want %v", keys, wantKeys)
+		}
+		values := templateRecipesValues(recipes)
+		if !reflect.DeepEqual(values, wantValues) {
+			t.Fatalf("templateRecipesValues = %v, want %v", values, wantValues)
+		}
+		if hash, _ := contentHash(nil, values...); hash != wantHash {
+			t.Fatalf("hash changed with map order: %s != %s", hash, wantHash)
+		}
+	}
+}
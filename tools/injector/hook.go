@@ -0,0 +1,176 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"hash"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// maxHookPayload is the max size of a webhook payload
+const maxHookPayload = 5 * 1024 * 1024
+
+// hookDebounce is the quiet delay waited after a hook, so that a burst of pushes triggers a single pass
+const hookDebounce = 10 * time.Second
+
+// syncTriggers wake up injector loop of each source, a pending trigger is enough for any number of hooks
+//
+// Map is filled at startup, before injector loops start
+var syncTriggers = make(map[string]chan bool)
+
+// triggerSync asks injector loop of source for a new pass, without blocking
+func triggerSync(source string) {
+	select {
+	case syncTriggers[source] <- true:
+	default:
+	}
+}
+
+// waitSync waits for delay or for a sync trigger of source, whichever comes first
+//
+// On trigger, it keeps waiting until no new trigger came during hookDebounce
+func waitSync(source string, delay time.Duration) {
+	syncTrigger := syncTriggers[source]
+	select {
+	case <-syncTrigger:
+		log.Info().Str("source", source).Msg("Sync triggered by hook")
+	case <-time.After(delay):
+		return
+	}
+	for {
+		select {
+		case <-syncTrigger:
+			log.Debug().Msg("Sync triggered again, waiting for end of burst")
+		case <-time.After(hookDebounce):
+			return
+		}
+	}
+}
+
+// checkHMAC checks hex encoded signature is the HMAC of payload with secret
+func checkHMAC(newHash func() hash.Hash, secret string, payload []byte, signature string) bool {
+	expected, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(newHash, []byte(secret))
+	mac.Write(payload)
+	return hmac.Equal(mac.Sum(nil), expected)
+}
+
+// checkHookSignature checks a GitHub, GitLab or Gitea hook request, and returns the event name
+func checkHookSignature(r *http.Request, secret string, payload []byte) (string, bool) {
+	if event := r.Header.Get("X-Gitea-Event"); event != "" {
+		return event, checkHMAC(sha256.New, secret, payload, r.Header.Get("X-Gitea-Signature"))
+	}
+	if event := r.Header.Get("X-Gitlab-Event"); event != "" {
+		token := r.Header.Get("X-Gitlab-Token")
+		return event, subtle.ConstantTimeCompare([]byte(token), []byte(secret)) == 1
+	}
+	if event := r.Header.Get("X-GitHub-Event"); event != "" {
+		if signature := r.Header.Get("X-Hub-Signature-256"); signature != "" {
+			return event, checkHMAC(sha256.New, secret, payload, strings.TrimPrefix(signature, "sha256="))
+		}
+		return event, checkHMAC(sha1.New, secret, payload, strings.TrimPrefix(r.Header.Get("X-Hub-Signature"), "sha1="))
+	}
+	return "", false
+}
+
+// HookHandler receives git push webhooks and wakes up injector
+var HookHandler = func(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Content-Type", "application/json")
+	secret := injectorConfig.HookSecret
+	if secret == "" {
+		w.WriteHeader(http.StatusForbidden)
+		respError := map[string]interface{}{"message": "hook secret not configured"}
+		json.NewEncoder(w).Encode(respError)
+		return
+	}
+
+	payload, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxHookPayload))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		respError := map[string]interface{}{"message": "failed to read payload"}
+		json.NewEncoder(w).Encode(respError)
+		return
+	}
+
+	event, ok := checkHookSignature(r, secret, payload)
+	if !ok {
+		log.Error().Str("event", event).Msg("Hook with invalid signature")
+		w.WriteHeader(http.StatusUnauthorized)
+		respError := map[string]interface{}{"message": "invalid signature"}
+		json.NewEncoder(w).Encode(respError)
+		return
+	}
+
+	switch strings.ToLower(event) {
+	case "push", "push hook", "tag push hook":
+	default:
+		resp := map[string]interface{}{"message": "event ignored", "event": event}
+		json.NewEncoder(w).Encode(resp)
+		return
+	}
+
+	push := hookPayload{}
+	json.Unmarshal(payload, &push)
+	log.Info().Str("event", event).Str("ref", push.Ref).Str("commit", push.After).Msg("Push hook received")
+
+	// Trigger sources of pushed repository, or all sources if repository is unknown
+	triggered := make([]string, 0)
+	for _, source := range injectorConfig.Sources {
+		if push.matches(source.Git) {
+			triggered = append(triggered, source.Name)
+		}
+	}
+	if len(triggered) == 0 {
+		for _, source := range injectorConfig.Sources {
+			triggered = append(triggered, source.Name)
+		}
+	}
+	for _, source := range triggered {
+		triggerSync(source)
+	}
+	w.WriteHeader(http.StatusAccepted)
+	resp := map[string]interface{}{"message": "sync triggered", "sources": triggered}
+	json.NewEncoder(w).Encode(resp)
+}
+
+// hookPayload is the subset of GitHub, GitLab and Gitea push payloads used by injector
+type hookPayload struct {
+	Ref        string `json:"ref"`
+	After      string `json:"after"`
+	Repository struct {
+		CloneURL   string `json:"clone_url"`
+		SSHURL     string `json:"ssh_url"`
+		HTMLURL    string `json:"html_url"`
+		GitHTTPURL string `json:"git_http_url"`
+		GitSSHURL  string `json:"git_ssh_url"`
+	} `json:"repository"`
+}
+
+// normalizeGitURL removes case, trailing slash and .git suffix of a repository url
+func normalizeGitURL(url string) string {
+	url = strings.ToLower(strings.TrimSuffix(url, "/"))
+	return strings.TrimSuffix(url, ".git")
+}
+
+// matches tells if pushed repository is gitURL
+func (p hookPayload) matches(gitURL string) bool {
+	repo := p.Repository
+	for _, url := range []string{repo.CloneURL, repo.SSHURL, repo.HTMLURL, repo.GitHTTPURL, repo.GitSSHURL} {
+		if url != "" && normalizeGitURL(url) == normalizeGitURL(gitURL) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"testing"
+)
+
+func TestCheckHMAC(t *testing.T) {
+	payload := []byte(`{"ref":"refs/heads/master"}`)
+	sign := func(newHash func() hash.Hash, secret string) string {
+		mac := hmac.New(newHash, []byte(secret))
+		mac.Write(payload)
+		return hex.EncodeToString(mac.Sum(nil))
+	}
+	tests := []struct {
+		name      string
+		newHash   func() hash.Hash
+		signature string
+		want      bool
+	}{
+		{name: "sha256", newHash: sha256.New, signature: sign(sha256.New, "secret"), want: true},
+		{name: "sha1", newHash: sha1.New, signature: sign(sha1.New, "secret"), want: true},
+		{name: "wrong secret", newHash: sha256.New, signature: sign(sha256.New, "other"), want: false},
+		{name: "wrong hash", newHash: sha256.New, signature: sign(sha1.New, "secret"), want: false},
+		{name: "truncated", newHash: sha256.New, signature: sign(sha256.New, "secret")[:32], want: false},
+		{name: "not hex", newHash: sha256.New, signature: "not-an-hex-signature", want: false},
+		{name: "with prefix", newHash: sha256.New, signature: "sha256=" + sign(sha256.New, "secret"), want: false},
+		{name: "empty", newHash: sha256.New, signature: "", want: false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := checkHMAC(test.newHash, "secret", payload, test.signature); got != test.want {
+				t.Errorf("checkHMAC() = %t, want %t", got, test.want)
+			}
+		})
+	}
+}
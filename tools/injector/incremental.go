@@ -0,0 +1,398 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	mongoOptions "go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/rs/zerolog/log"
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+
+	terraGitModel "github.com/osallou/goterra-community/tools/model"
+)
+
+// changeSet lists the items changed between two commits, keyed as in gitItems
+//
+// A nil changeSet means a full sync, where every item is processed
+type changeSet struct {
+	recipes   map[string]bool
+	templates map[string]bool
+	endpoints map[string]bool
+	apps      map[string]bool
+}
+
+// full tells if every item must be processed
+func (c *changeSet) full() bool {
+	return c == nil
+}
+
+// has tells if item of kind must be processed
+func (c *changeSet) has(kind string, key string) bool {
+	if c == nil {
+		return true
+	}
+	return c.items(kind)[key]
+}
+
+// items returns the changed items of kind, c must not be nil
+func (c *changeSet) items(kind string) map[string]bool {
+	switch kind {
+	case kindRecipe:
+		return c.recipes
+	case kindTemplate:
+		return c.templates
+	case kindEndpoint:
+		return c.endpoints
+	case kindApplication:
+		return c.apps
+	}
+	return nil
+}
+
+// add records path as changed, if it belongs to a catalog item
+func (c *changeSet) add(path string) {
+	elts := strings.Split(path, "/")
+	if len(elts) < 3 {
+		return
+	}
+	switch elts[0] {
+	case "endpoints":
+		c.endpoints[elts[1]] = true
+	case "recipes", "templates", "apps":
+		if len(elts) < 4 {
+			return
+		}
+		key := elts[1] + "/" + elts[2]
+		switch elts[0] {
+		case "recipes":
+			c.recipes[key] = true
+		case "templates":
+			c.templates[key] = true
+		case "apps":
+			c.apps[key] = true
+		}
+	}
+}
+
+// diffCommits returns the items changed between commits from and to
+func diffCommits(repo *git.Repository, from string, to string) (*changeSet, error) {
+	fromCommit, err := repo.CommitObject(plumbing.NewHash(from))
+	if err != nil {
+		return nil, err
+	}
+	toCommit, err := repo.CommitObject(plumbing.NewHash(to))
+	if err != nil {
+		return nil, err
+	}
+	fromTree, err := fromCommit.Tree()
+	if err != nil {
+		return nil, err
+	}
+	toTree, err := toCommit.Tree()
+	if err != nil {
+		return nil, err
+	}
+	changes, err := fromTree.Diff(toTree)
+	if err != nil {
+		return nil, err
+	}
+	c := &changeSet{
+		recipes:   make(map[string]bool),
+		templates: make(map[string]bool),
+		endpoints: make(map[string]bool),
+		apps:      make(map[string]bool),
+	}
+	for _, change := range changes {
+		if change.From.Name != "" {
+			c.add(change.From.Name)
+		}
+		if change.To.Name != "" {
+			c.add(change.To.Name)
+		}
+	}
+	return c, nil
+}
+
+// syncState is the injection state of a source, stored in injector collection
+//
+// Failed are the catalog paths of the files which failed in last pass, injected again in next one.
+// Catalog lists the items of injected commit, with their references
+type syncState struct {
+	Source   string        `bson:"source"`
+	Commit   string        `bson:"commit"`
+	Full     int64         `bson:"full"`
+	Modified int64         `bson:"modified"`
+	Failed   []string      `bson:"failed"`
+	Catalog  []catalogNode `bson:"catalog"`
+}
+
+// getSyncState returns last injection state of source, empty if source was never injected
+func getSyncState(source string) syncState {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	state := syncState{Source: source}
+	err := injectorCollection.FindOne(ctx, bson.M{"source": source}).Decode(&state)
+	if err != nil {
+		log.Info().Str("source", source).Msg("No previous injection state")
+	}
+	return state
+}
+
+// saveSyncState records injection state of a source
+func saveSyncState(state syncState) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	state.Modified = time.Now().Unix()
+	_, err := injectorCollection.ReplaceOne(ctx, bson.M{"source": state.Source}, state, mongoOptions.Replace().SetUpsert(true))
+	if err != nil {
+		log.Error().Str("source", state.Source).Msgf("Failed to save injection state: %s", err)
+	}
+}
+
+// passChanges returns the changes to inject from last injected commit, and the items which failed
+// in last pass, nil if a full sync is needed
+func passChanges(repo *git.Repository, state syncState, commit string) *changeSet {
+	if injectorConfig.FullSync || state.Commit == "" || len(state.Catalog) == 0 {
+		return nil
+	}
+	if injectorConfig.FullSyncInterval > 0 && time.Now().Unix()-state.Full > int64(injectorConfig.FullSyncInterval*3600) {
+		log.Info().Str("source", state.Source).Msg("Full sync interval reached")
+		return nil
+	}
+	changes, err := diffCommits(repo, state.Commit, commit)
+	if err != nil {
+		log.Warn().Str("source", state.Source).Msgf("Cannot diff with last injected commit %s, full sync: %s", state.Commit, err)
+		return nil
+	}
+	for _, file := range state.Failed {
+		changes.add(file)
+	}
+	return changes
+}
+
+// addDependents adds to changes the recipes inheriting from a changed recipe,
+// and the applications using a changed recipe or template, found in catalog items
+//
+// References are matched as written: a name@constraint reference depends on every version of name,
+// as adding or removing one may change the version it resolves to
+func (c *changeSet) addDependents(items catalog) {
+	if c == nil {
+		return
+	}
+	// Recipes inheriting from a changed recipe, at any depth
+	for added := true; added; {
+		added = false
+		for key, node := range items[kindRecipe] {
+			if !c.recipes[key] && c.references(kindRecipe, node.Parent) {
+				c.recipes[key] = true
+				added = true
+			}
+		}
+	}
+	for key, node := range items[kindApplication] {
+		if c.references(kindTemplate, node.Template) {
+			c.apps[key] = true
+			continue
+		}
+		for _, ref := range node.Recipes {
+			if c.references(kindRecipe, ref) {
+				c.apps[key] = true
+				break
+			}
+		}
+	}
+}
+
+// references tells if ref may designate a changed item of kind
+func (c *changeSet) references(kind string, ref string) bool {
+	if ref == "" {
+		return false
+	}
+	for key := range c.items(kind) {
+		if terraGitModel.References(ref, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// catalogKinds are the kinds of catalog items, in injection order
+var catalogKinds = []string{kindRecipe, kindTemplate, kindEndpoint, kindApplication}
+
+// catalogDirs are the directories of catalog items, per kind
+var catalogDirs = map[string]string{
+	kindRecipe:      "recipes",
+	kindTemplate:    "templates",
+	kindEndpoint:    "endpoints",
+	kindApplication: "apps",
+}
+
+// catalogFiles are the definition files of catalog items, per kind
+var catalogFiles = map[string]string{
+	kindRecipe:      "recipe.yaml",
+	kindTemplate:    "template.yaml",
+	kindEndpoint:    "endpoint.yaml",
+	kindApplication: "app.yaml",
+}
+
+// catalogNode is an item of the catalog of a source, with the references of its definition as written
+//
+// Nodes are stored in sync state, so that an incremental pass only reads changed items
+type catalogNode struct {
+	Kind string `bson:"kind"`
+	Key  string `bson:"key"`
+	// Base and Parent of a recipe
+	Base   []string `bson:"base,omitempty"`
+	Parent string   `bson:"parent,omitempty"`
+	// Template and Recipes of an application
+	Template string   `bson:"template,omitempty"`
+	Recipes  []string `bson:"recipes,omitempty"`
+}
+
+// catalog indexes the catalog nodes of a source by kind and key, keys are the ones of gitItems
+type catalog map[string]map[string]catalogNode
+
+// newCatalog indexes nodes
+func newCatalog(nodes []catalogNode) catalog {
+	items := make(catalog)
+	for _, kind := range catalogKinds {
+		items[kind] = make(map[string]catalogNode)
+	}
+	for _, node := range nodes {
+		if items[node.Kind] != nil {
+			items[node.Kind][node.Key] = node
+		}
+	}
+	return items
+}
+
+// nodes returns the nodes of catalog, sorted by kind and key
+func (items catalog) nodes() []catalogNode {
+	nodes := make([]catalogNode, 0)
+	for _, kind := range catalogKinds {
+		for _, key := range items.keys(kind) {
+			nodes = append(nodes, items[kind][key])
+		}
+	}
+	return nodes
+}
+
+// keys returns the sorted keys of items of kind
+func (items catalog) keys(kind string) []string {
+	keys := make([]string, 0, len(items[kind]))
+	for key := range items[kind] {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// itemFile returns the definition file of item key of kind in gitDir
+func itemFile(gitDir string, kind string, key string) string {
+	return filepath.Join(gitDir, catalogDirs[kind], key, catalogFiles[kind])
+}
+
+// scan adds the items of kind found in gitDir
+func (items catalog) scan(gitDir string, kind string) error {
+	files, err := findFiles(filepath.Join(gitDir, catalogDirs[kind]), catalogFiles[kind])
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		elts := strings.Split(filepath.ToSlash(file), "/")
+		key := elts[len(elts)-2]
+		if kind != kindEndpoint {
+			key = elts[len(elts)-3] + "/" + key
+		}
+		items.update(gitDir, kind, key)
+	}
+	return nil
+}
+
+// update reads item key of kind in gitDir, or removes it if its definition file does not exist anymore
+func (items catalog) update(gitDir string, kind string, key string) {
+	file := itemFile(gitDir, kind, key)
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		delete(items[kind], key)
+		return
+	}
+	// Invalid definitions are reported when processed, only their references matter here
+	node := catalogNode{Kind: kind, Key: key}
+	switch kind {
+	case kindRecipe:
+		t := terraGitModel.RecipeDefinition{}
+		if terraGitModel.Decode(file, data, &t) == nil {
+			node.Base = t.Recipe.Base
+			node.Parent = t.Recipe.Parent
+		}
+	case kindApplication:
+		t := terraGitModel.ApplicationDefinition{}
+		if terraGitModel.Decode(file, data, &t) == nil {
+			node.Template = t.Application.Template
+			slots := make([]string, 0, len(t.Application.Recipes))
+			for slot := range t.Application.Recipes {
+				slots = append(slots, slot)
+			}
+			sort.Strings(slots)
+			for _, slot := range slots {
+				node.Recipes = append(node.Recipes, t.Application.Recipes[slot]...)
+			}
+		}
+	}
+	items[kind][key] = node
+}
+
+// parents returns the parents of recipes, resolved in gitDir, unresolved references are kept as is
+func (items catalog) parents(gitDir string) map[string]string {
+	parents := make(map[string]string)
+	for key, node := range items[kindRecipe] {
+		parents[key] = node.Parent
+		if node.Parent == "" {
+			continue
+		}
+		if parent, err := terraGitModel.ResolveRecipe(gitDir, node.Parent); err == nil {
+			parents[key] = parent
+		}
+	}
+	return parents
+}
+
+// files returns the definition files of the items of kind in changes, sorted by key
+func (items catalog) files(gitDir string, kind string, changes *changeSet) []string {
+	files := make([]string, 0)
+	for _, key := range items.keys(kind) {
+		if changes.has(kind, key) {
+			files = append(files, itemFile(gitDir, kind, key))
+		}
+	}
+	return files
+}
+
+// found returns the items of catalog, for pruning, kinds whose directory does not exist are not listed
+func (items catalog) found(gitDir string) gitItems {
+	keys := func(kind string) map[string]bool {
+		if _, err := os.Stat(filepath.Join(gitDir, catalogDirs[kind])); err != nil {
+			return nil
+		}
+		found := make(map[string]bool)
+		for key := range items[kind] {
+			found[key] = true
+		}
+		return found
+	}
+	return gitItems{
+		recipes:   keys(kindRecipe),
+		templates: keys(kindTemplate),
+		endpoints: keys(kindEndpoint),
+		apps:      keys(kindApplication),
+	}
+}
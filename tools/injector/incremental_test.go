@@ -0,0 +1,194 @@
+package main
+
+import (
+	"os"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func recipeYaml(name string, parent string) string {
+	return "recipe:\n  name: " + name + "\n  license: Apache-2.0\n  base: [debian]\n  parent: " + parent + "\n"
+}
+
+// testCatalog is the catalog of test repositories
+var testCatalog = map[string]string{
+	"recipes/base/v1.0/recipe.yaml":       recipeYaml("base", ""),
+	"recipes/base/v1.0/recipe.sh":         "#!/bin/bash\n",
+	"recipes/child/v1.0/recipe.yaml":      recipeYaml("child", "base/v1.0"),
+	"recipes/grandchild/v1.0/recipe.yaml": recipeYaml("grandchild", "child@^1.0"),
+	"recipes/other/v1.0/recipe.yaml":      recipeYaml("other", ""),
+	"templates/vm/v1.0/template.yaml":     "template:\n  name: vm\n  license: Apache-2.0\n  files:\n    openstack: app.tf\n",
+	"endpoints/cloud/endpoint.yaml":       "endpoint:\n  name: cloud\n  kind: openstack\n",
+	"apps/grand/v1.0/app.yaml":            "application:\n  name: grand\n  template: vm/v1.0\n  recipes:\n    vm: [grandchild/v1.0]\n",
+	"apps/plain/v1.0/app.yaml":            "application:\n  name: plain\n  template: vm/v1.0\n  recipes:\n    vm: [other/v1.0]\n",
+	"apps/latest/v1.0/app.yaml":           "application:\n  name: latest\n  template: vm@latest\n",
+}
+
+// keys returns the keys of a changed items set
+func keys(items map[string]bool) []string {
+	list := make([]string, 0, len(items))
+	for key := range items {
+		list = append(list, key)
+	}
+	sort.Strings(list)
+	return list
+}
+
+func TestDiffCommits(t *testing.T) {
+	r := newTestRepo(t)
+	defer os.RemoveAll(r.dir)
+	first := r.commit(testCatalog)
+	second := r.commit(map[string]string{
+		"recipes/base/v1.0/recipe.sh":        "#!/bin/bash\necho\n",
+		"recipes/other/v1.0/recipe.yaml":     "",
+		"endpoints/cloud/endpoint.yaml":      "endpoint:\n  name: cloud\n  kind: aws\n",
+		"templates/vm/v1.0/openstack/app.tf": "variable \"a\" {}\n",
+		"README.md":                          "catalog\n",
+	})
+
+	changes, err := diffCommits(r.repo, first, second)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	want := map[string][]string{
+		kindRecipe:      {"base/v1.0", "other/v1.0"},
+		kindTemplate:    {"vm/v1.0"},
+		kindEndpoint:    {"cloud"},
+		kindApplication: {},
+	}
+	for kind, items := range want {
+		if got := keys(changes.items(kind)); !reflect.DeepEqual(got, items) {
+			t.Errorf("changed %s = %v, want %v", kind, got, items)
+		}
+	}
+}
+
+func TestAddDependents(t *testing.T) {
+	r := newTestRepo(t)
+	defer os.RemoveAll(r.dir)
+	r.commit(testCatalog)
+	items := newCatalog(nil)
+	for _, kind := range catalogKinds {
+		if err := items.scan(r.dir, kind); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name        string
+		recipes     []string
+		templates   []string
+		recipesWant []string
+		appsWant    []string
+	}{
+		{
+			name:        "parent recipe",
+			recipes:     []string{"base/v1.0"},
+			recipesWant: []string{"base/v1.0", "child/v1.0", "grandchild/v1.0"},
+			appsWant:    []string{"grand/v1.0"},
+		},
+		{
+			name:        "constraint reference",
+			recipes:     []string{"child/v2.0"},
+			recipesWant: []string{"child/v2.0", "grandchild/v1.0"},
+			appsWant:    []string{"grand/v1.0"},
+		},
+		{
+			name:        "leaf recipe",
+			recipes:     []string{"other/v1.0"},
+			recipesWant: []string{"other/v1.0"},
+			appsWant:    []string{"plain/v1.0"},
+		},
+		{
+			name:        "template",
+			templates:   []string{"vm/v1.0"},
+			recipesWant: []string{},
+			appsWant:    []string{"grand/v1.0", "latest/v1.0", "plain/v1.0"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			changes := &changeSet{
+				recipes:   make(map[string]bool),
+				templates: make(map[string]bool),
+				endpoints: make(map[string]bool),
+				apps:      make(map[string]bool),
+			}
+			for _, key := range test.recipes {
+				changes.recipes[key] = true
+			}
+			for _, key := range test.templates {
+				changes.templates[key] = true
+			}
+			changes.addDependents(items)
+			if got := keys(changes.recipes); !reflect.DeepEqual(got, test.recipesWant) {
+				t.Errorf("recipes = %v, want %v", got, test.recipesWant)
+			}
+			if got := keys(changes.apps); !reflect.DeepEqual(got, test.appsWant) {
+				t.Errorf("apps = %v, want %v", got, test.appsWant)
+			}
+		})
+	}
+
+	// Full sync has no dependents to add
+	var full *changeSet
+	full.addDependents(items)
+	if !full.full() {
+		t.Errorf("full sync changed by dependents")
+	}
+}
+
+func TestPassChanges(t *testing.T) {
+	r := newTestRepo(t)
+	defer os.RemoveAll(r.dir)
+	first := r.commit(testCatalog)
+	second := r.commit(map[string]string{"recipes/base/v1.0/recipe.sh": "#!/bin/bash\necho\n"})
+	items := newCatalog(nil)
+	for _, kind := range catalogKinds {
+		if err := items.scan(r.dir, kind); err != nil {
+			t.Fatal(err)
+		}
+	}
+	now := time.Now().Unix()
+	state := syncState{Source: "test", Commit: first, Full: now, Catalog: items.nodes()}
+
+	defer func(config InjectorConfig) { injectorConfig = config }(injectorConfig)
+	injectorConfig = InjectorConfig{FullSyncInterval: 24}
+
+	if changes := passChanges(r.repo, state, second); changes.full() || !reflect.DeepEqual(keys(changes.recipes), []string{"base/v1.0"}) {
+		t.Errorf("incremental pass changes = %+v, want base/v1.0", changes)
+	}
+
+	failed := state
+	failed.Failed = []string{"apps/plain/v1.0/app.yaml", "endpoints/cloud/endpoint.yaml"}
+	changes := passChanges(r.repo, failed, second)
+	if changes.full() || !changes.has(kindApplication, "plain/v1.0") || !changes.has(kindEndpoint, "cloud") || !changes.has(kindRecipe, "base/v1.0") {
+		t.Errorf("failed items are not retried: %+v", changes)
+	}
+
+	fullTests := []struct {
+		name   string
+		state  func(s syncState) syncState
+		config InjectorConfig
+	}{
+		{name: "interval reached", state: func(s syncState) syncState { s.Full = now - 25*3600; return s }, config: InjectorConfig{FullSyncInterval: 24}},
+		{name: "full sync config", state: func(s syncState) syncState { return s }, config: InjectorConfig{FullSync: true, FullSyncInterval: 24}},
+		{name: "never injected", state: func(s syncState) syncState { s.Commit = ""; return s }, config: InjectorConfig{FullSyncInterval: 24}},
+		{name: "no catalog", state: func(s syncState) syncState { s.Catalog = nil; return s }, config: InjectorConfig{FullSyncInterval: 24}},
+		{name: "unknown commit", state: func(s syncState) syncState { s.Commit = "0123456789012345678901234567890123456789"; return s }, config: InjectorConfig{FullSyncInterval: 24}},
+	}
+	for _, test := range fullTests {
+		injectorConfig = test.config
+		if changes := passChanges(r.repo, test.state(state), second); !changes.full() {
+			t.Errorf("%s: changes = %+v, want full sync", test.name, changes)
+		}
+	}
+	injectorConfig = InjectorConfig{FullSyncInterval: -1}
+	old := state
+	old.Full = 0
+	if changes := passChanges(r.repo, old, second); changes.full() {
+		t.Errorf("disabled interval: want incremental pass")
+	}
+}
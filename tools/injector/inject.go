@@ -0,0 +1,606 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	terraGitModel "github.com/osallou/goterra-community/tools/model"
+	terraModel "github.com/osallou/goterra-lib/lib/model"
+)
+
+// Kinds of injected items
+const (
+	kindRecipe      = "recipe"
+	kindTemplate    = "template"
+	kindEndpoint    = "endpoint"
+	kindApplication = "application"
+)
+
+// loadRecipes reads and checks recipe definitions, keyed by name/version
+//
+// Invalid recipes are reported in run
+func loadRecipes(gitDir string, files []string, run *SyncRun) map[string]terraGitModel.RecipeDefinition {
+	recipes := make(map[string]terraGitModel.RecipeDefinition)
+	for _, file := range files {
+		elts := strings.Split(file, "/")
+		key := elts[len(elts)-3] + "/" + elts[len(elts)-2]
+		yamlRecipe, _ := ioutil.ReadFile(file)
+		t := terraGitModel.RecipeDefinition{}
+		t.Recipe.Path = file
+		err := terraGitModel.Decode(file, yamlRecipe, &t)
+		if err != nil {
+			log.Error().Msgf("Failed to read %s: %s", file, err)
+			run.fail(kindRecipe, file, err)
+			continue
+		}
+		errCheck := t.Recipe.Check(gitDir).Err()
+		if errCheck != nil {
+			log.Error().Msgf("Recipe did not pass the check!  %s: %s", t.Recipe.Path, errCheck)
+			run.fail(kindRecipe, file, errCheck)
+			continue
+		}
+		recipes[key] = t
+	}
+	return recipes
+}
+
+// injectRecipe creates or updates a recipe, its parent must already be in createdRecipes
+//
+// On success, or if recipe is frozen, recipe id is added to createdRecipes
+func injectRecipe(ns string, gitDir string, name string, version string, t terraGitModel.RecipeDefinition, createdRecipes *idIndex, run *SyncRun) error {
+	recipe, meta, rerr := getRecipe(ns, name, version)
+	if rerr == nil && recipe.Frozen {
+		log.Error().Str("recipe", name).Str("version", version).Msg("Recipe is frozen, cannot update")
+		createdRecipes.set(name+"/"+version, recipe.ID.Hex())
+		run.record(kindRecipe, name+"/"+version, actionFrozen)
+		return nil
+	}
+	if rerr != nil {
+		// Does not exists
+		log.Debug().Msgf("Recipe does not exists %s:%s", name, version)
+		recipe = &terraModel.Recipe{}
+		recipe.Remote = name
+		recipe.RemoteVersion = version
+	} else {
+		// Exists
+		log.Debug().Msgf("Recipe exists %s:%s", name, version)
+	}
+	recipe.Name = t.Recipe.Name
+	recipe.BaseImages = t.Recipe.Base
+	recipe.Tags = t.Recipe.Tags
+	recipe.Timestamp = time.Now().Unix()
+	recipe.Inputs = t.Recipe.Inputs.Descriptions()
+	recipe.Namespace = ns
+	recipe.Description = t.Recipe.Description
+	recipe.Public = run.public
+	recipe.Version = version
+	scriptFile := fmt.Sprintf("%s/recipes/%s/%s/recipe.sh", gitDir, name, version)
+	script, scriptErr := ioutil.ReadFile(scriptFile)
+	if scriptErr != nil {
+		return fmt.Errorf("could not read recipe script %s", t.Recipe.Path)
+	}
+	recipe.Defaults = t.Recipe.Defaults
+	recipe.Script = string(script)
+	recipe.ParentRecipe = ""
+	if t.Recipe.Parent != "" {
+		parentID, ok := createdRecipes.get(t.Recipe.Parent)
+		if !ok {
+			return fmt.Errorf("parent recipe %s was not injected", t.Recipe.Parent)
+		}
+		recipe.ParentRecipe = parentID
+	}
+
+	hash, hashErr := contentHash([]string{t.Recipe.Path, scriptFile}, ns, strconv.FormatBool(run.public), recipe.ParentRecipe)
+	if hashErr != nil {
+		return hashErr
+	}
+	changed := rerr != nil || meta.Hash != hash || meta.Deprecated
+	if run.dryRun() {
+		run.planned(kindRecipe, name+"/"+version, rerr == nil, changed)
+		createdRecipes.set(name+"/"+version, plannedID(recipe.ID.Hex(), name+"/"+version))
+		return nil
+	}
+	if !changed {
+		log.Debug().Msgf("Recipe unchanged %s:%s", name, version)
+		createdRecipes.set(name+"/"+version, recipe.ID.Hex())
+		run.record(kindRecipe, name+"/"+version, actionUnchanged)
+		return nil
+	}
+
+	if rerr != nil {
+		id, newErr := createRecipe(ns, recipe, injectionMeta{Commit: run.Commit, Hash: hash, InputSchema: t.Recipe.Inputs})
+		if newErr != nil {
+			return newErr
+		}
+		createdRecipes.set(name+"/"+version, id)
+		run.record(kindRecipe, name+"/"+version, actionCreated)
+	} else {
+		if updateErr := updateRecipe(ns, recipe, injectionMeta{Commit: run.Commit, Hash: hash, InputSchema: t.Recipe.Inputs}); updateErr != nil {
+			return updateErr
+		}
+		createdRecipes.set(name+"/"+version, recipe.ID.Hex())
+		run.record(kindRecipe, name+"/"+version, actionUpdated)
+	}
+	return nil
+}
+
+// loadTemplate reads and checks a template definition
+func loadTemplate(file string) (terraGitModel.TemplateDefinition, error) {
+	yamlTemplate, _ := ioutil.ReadFile(file)
+	t := terraGitModel.TemplateDefinition{}
+	t.Template.Path = file
+	err := terraGitModel.Decode(file, yamlTemplate, &t)
+	if err != nil {
+		log.Error().Msgf("Failed to read %s: %s", file, err)
+		return t, err
+	}
+	errCheck := t.Template.Check().Err()
+	if errCheck != nil {
+		log.Error().Msgf("Template did not pass the check!  %s: %s", t.Template.Path, errCheck)
+		return t, errCheck
+	}
+	return t, nil
+}
+
+// injectTemplate creates or updates a template
+//
+// On success, or if template is frozen, template id is added to createdTemplates
+func injectTemplate(ns string, gitDir string, name string, version string, t terraGitModel.TemplateDefinition, createdTemplates *idIndex, run *SyncRun) error {
+	template, meta, rerr := getTemplate(ns, name, version)
+	if rerr == nil && template.Frozen {
+		log.Error().Str("template", name).Str("version", version).Msg("Template is frozen, cannot update")
+		createdTemplates.set(name+"/"+version, template.ID.Hex())
+		run.record(kindTemplate, name+"/"+version, actionFrozen)
+		return nil
+	}
+	if rerr != nil {
+		// Does not exists
+		log.Debug().Msgf("Template does not exists %s:%s", name, version)
+		template = &terraModel.Template{}
+		template.Remote = name
+		template.RemoteVersion = version
+	} else {
+		// Exists
+		log.Debug().Msgf("Template exists %s:%s", name, version)
+	}
+	template.Name = t.Template.Name
+	template.Tags = t.Template.Tags
+	template.Timestamp = time.Now().Unix()
+	template.Inputs = t.Template.Inputs.Descriptions()
+	template.Namespace = ns
+	template.Description = t.Template.Description
+	template.Public = run.public
+	template.Version = version
+	template.Defaults = t.Template.Defaults
+	template.Data = make(map[string]string)
+	sourceFiles := []string{t.Template.Path}
+	for _, cloud := range sortedKeys(t.Template.Files) {
+		scriptFile := fmt.Sprintf("%s/templates/%s/%s/%s/%s", gitDir, name, version, cloud, t.Template.Files[cloud])
+		script, scriptErr := ioutil.ReadFile(scriptFile)
+		if scriptErr != nil {
+			return fmt.Errorf("could not read template script %s", scriptFile)
+		}
+		template.Data[cloud] = string(script)
+		sourceFiles = append(sourceFiles, scriptFile)
+	}
+	if t.Template.Recipes == nil {
+		t.Template.Recipes = make([]string, 0)
+	}
+	template.VarRecipes = t.Template.Recipes
+
+	hash, hashErr := contentHash(sourceFiles, ns, strconv.FormatBool(run.public))
+	if hashErr != nil {
+		return hashErr
+	}
+	changed := rerr != nil || meta.Hash != hash || meta.Deprecated
+	if run.dryRun() {
+		run.planned(kindTemplate, name+"/"+version, rerr == nil, changed)
+		createdTemplates.set(name+"/"+version, plannedID(template.ID.Hex(), name+"/"+version))
+		return nil
+	}
+	if !changed {
+		log.Debug().Msgf("Template unchanged %s:%s", name, version)
+		createdTemplates.set(name+"/"+version, template.ID.Hex())
+		run.record(kindTemplate, name+"/"+version, actionUnchanged)
+		return nil
+	}
+
+	if rerr != nil {
+		id, newErr := createTemplate(ns, template, injectionMeta{Commit: run.Commit, Hash: hash, InputSchema: t.Template.Inputs})
+		if newErr != nil {
+			return newErr
+		}
+		createdTemplates.set(name+"/"+version, id)
+		run.record(kindTemplate, name+"/"+version, actionCreated)
+	} else {
+		if updateErr := updateTemplate(ns, template, injectionMeta{Commit: run.Commit, Hash: hash, InputSchema: t.Template.Inputs}); updateErr != nil {
+			return updateErr
+		}
+		createdTemplates.set(name+"/"+version, template.ID.Hex())
+		run.record(kindTemplate, name+"/"+version, actionUpdated)
+	}
+	return nil
+}
+
+// loadEndpoint reads and checks an endpoint definition
+func loadEndpoint(file string) (terraGitModel.EndpointDefinition, error) {
+	yamlEndpoint, _ := ioutil.ReadFile(file)
+	t := terraGitModel.EndpointDefinition{}
+	t.Endpoint.Path = file
+	err := terraGitModel.Decode(file, yamlEndpoint, &t)
+	if err != nil {
+		log.Error().Msgf("Failed to read %s: %s", file, err)
+		return t, err
+	}
+	errCheck := t.Endpoint.Check().Err()
+	if errCheck != nil {
+		log.Error().Msgf("Endpoint did not pass the check!  %s: %s", t.Endpoint.Path, errCheck)
+		return t, errCheck
+	}
+	return t, nil
+}
+
+// injectEndpoint creates or updates an endpoint
+func injectEndpoint(ns string, name string, t terraGitModel.EndpointDefinition, run *SyncRun) error {
+	endpoint, meta, rerr := getEndpoint(ns, name)
+	if rerr != nil {
+		// Does not exists
+		log.Debug().Msgf("Endpoint does not exists %s", name)
+		endpoint = &terraModel.EndPoint{}
+	} else {
+		// Exists
+		log.Debug().Msgf("Endpoint exists %s", name)
+	}
+	endpoint.Name = t.Endpoint.Name
+	endpoint.Remote = name
+	endpoint.Timestamp = time.Now().Unix()
+	endpoint.Namespace = ns
+	endpoint.Public = run.public
+	endpoint.Kind = t.Endpoint.Kind
+	endpoint.Defaults = t.Endpoint.Defaults
+	endpoint.Features = t.Endpoint.Features
+	if endpoint.Features == nil {
+		endpoint.Features = make(map[string]string)
+	}
+	endpoint.Inputs = t.Endpoint.Inputs.Descriptions()
+
+	endpoint.Config = t.Endpoint.Config
+	if endpoint.Config == nil {
+		endpoint.Config = make(map[string]string)
+	}
+
+	endpoint.Images = t.Endpoint.Images
+	if endpoint.Images == nil {
+		endpoint.Images = make(map[string]string)
+	}
+
+	hash, hashErr := contentHash([]string{t.Endpoint.Path}, ns, strconv.FormatBool(run.public))
+	if hashErr != nil {
+		return hashErr
+	}
+	changed := rerr != nil || meta.Hash != hash || meta.Deprecated
+	if run.dryRun() {
+		run.planned(kindEndpoint, name, rerr == nil, changed)
+		return nil
+	}
+	if !changed {
+		log.Debug().Msgf("Endpoint unchanged %s", name)
+		run.record(kindEndpoint, name, actionUnchanged)
+		return nil
+	}
+
+	if rerr != nil {
+		if _, newErr := createEndpoint(ns, endpoint, injectionMeta{Commit: run.Commit, Hash: hash, InputSchema: t.Endpoint.Inputs}); newErr != nil {
+			return newErr
+		}
+		run.record(kindEndpoint, name, actionCreated)
+	} else {
+		if updateErr := updateEndpoint(ns, endpoint, injectionMeta{Commit: run.Commit, Hash: hash, InputSchema: t.Endpoint.Inputs}); updateErr != nil {
+			return updateErr
+		}
+		run.record(kindEndpoint, name, actionUpdated)
+	}
+	return nil
+}
+
+// loadApplication reads and checks an application definition, and returns its expected recipes
+func loadApplication(gitDir string, file string) (terraGitModel.ApplicationDefinition, []string, error) {
+	yamlApp, _ := ioutil.ReadFile(file)
+	t := terraGitModel.ApplicationDefinition{}
+	t.Application.Path = file
+	err := terraGitModel.Decode(file, yamlApp, &t)
+	if err != nil {
+		log.Error().Msgf("Failed to read %s: %s", file, err)
+		return t, nil, err
+	}
+
+	expectedRecipes, findings := t.Application.Check(gitDir)
+	if errCheck := findings.Err(); errCheck != nil {
+		log.Error().Msgf("Application did not pass the check!  %s: %s", t.Application.Path, errCheck)
+		return t, nil, errCheck
+	}
+	for _, warning := range findings {
+		log.Warn().Str("application", t.Application.Path).Str("rule", warning.Rule).Msg(warning.Error())
+	}
+	return t, expectedRecipes, nil
+}
+
+// injectApplication creates or updates an application, its template and recipes must already be injected
+func injectApplication(ns string, name string, version string, t terraGitModel.ApplicationDefinition, baseImages []string, createdTemplates *idIndex, createdRecipes *idIndex, run *SyncRun) error {
+	application, meta, rerr := getApplication(ns, name, version)
+	if rerr == nil && application.Frozen {
+		log.Error().Str("application", name).Str("version", version).Msg("App is frozen, cannot update")
+		run.record(kindApplication, name+"/"+version, actionFrozen)
+		return nil
+	}
+	if rerr != nil {
+		// Does not exists
+		log.Debug().Msgf("Application does not exists %s", name)
+		application = &terraModel.Application{}
+		application.Remote = name
+		application.RemoteVersion = version
+	} else {
+		// Exists
+		log.Debug().Msgf("Application exists %s", name)
+	}
+	application.Name = t.Application.Name
+	application.Image = baseImages
+	application.Description = t.Application.Description
+	application.Version = version
+	application.Timestamp = time.Now().Unix()
+	application.Namespace = ns
+	application.Public = run.public
+	application.Defaults = t.Application.Defaults
+	application.Template, _ = createdTemplates.get(t.Application.Template)
+	application.TemplateRecipes = make(map[string][]string)
+	for tplVar, recipes := range t.Application.Recipes {
+		for _, recipe := range recipes {
+			recipeID, ok := createdRecipes.get(recipe)
+			if !ok {
+				log.Error().Msgf("App %s requests recipe %s, but it does not exists!", t.Application.Name, recipe)
+				return fmt.Errorf("recipe %s does not exists", recipe)
+			}
+			if application.TemplateRecipes[tplVar] == nil {
+				application.TemplateRecipes[tplVar] = make([]string, 0)
+			}
+			application.TemplateRecipes[tplVar] = append(application.TemplateRecipes[tplVar], recipeID)
+		}
+	}
+
+	// Application also changes if its template, recipes or base images changed
+	references := []string{ns, strconv.FormatBool(run.public), application.Template, strings.Join(baseImages, ",")}
+	references = append(references, templateRecipesValues(application.TemplateRecipes)...)
+	hash, hashErr := contentHash([]string{t.Application.Path}, references...)
+	if hashErr != nil {
+		return hashErr
+	}
+	changed := rerr != nil || meta.Hash != hash || meta.Deprecated
+	if run.dryRun() {
+		run.planned(kindApplication, name+"/"+version, rerr == nil, changed)
+		return nil
+	}
+	if !changed {
+		log.Debug().Msgf("Application unchanged %s:%s", name, version)
+		run.record(kindApplication, name+"/"+version, actionUnchanged)
+		return nil
+	}
+
+	if rerr != nil {
+		if _, newErr := createApplication(ns, application, injectionMeta{Commit: run.Commit, Hash: hash}); newErr != nil {
+			return newErr
+		}
+		run.record(kindApplication, name+"/"+version, actionCreated)
+	} else {
+		if updateErr := updateApplication(ns, application, injectionMeta{Commit: run.Commit, Hash: hash}); updateErr != nil {
+			return updateErr
+		}
+		run.record(kindApplication, name+"/"+version, actionUpdated)
+	}
+	return nil
+}
+
+// idIndex maps the name/version keys of a kind to the ids of their documents in namespace
+//
+// During an incremental pass, keys of items not processed are looked up in db when needed
+type idIndex struct {
+	ids    map[string]string
+	lookup func(key string) (string, error)
+}
+
+// newIDIndex creates an index, lookup is nil or gets id of an item not processed in pass
+func newIDIndex(lookup func(key string) (string, error)) *idIndex {
+	return &idIndex{ids: make(map[string]string), lookup: lookup}
+}
+
+// set records id of key
+func (x *idIndex) set(key string, id string) {
+	x.ids[key] = id
+}
+
+// get returns id of key
+func (x *idIndex) get(key string) (string, bool) {
+	if id, ok := x.ids[key]; ok {
+		return id, true
+	}
+	if x.lookup == nil {
+		return "", false
+	}
+	id, err := x.lookup(key)
+	if err != nil {
+		return "", false
+	}
+	x.ids[key] = id
+	return id, true
+}
+
+// syncPass injects recipes, templates, endpoints and applications of git checkout in namespace
+//
+// If changes is nil, items catalog is scanned from checkout. Else only changed items are read to
+// update items catalog, of last pass, and only them and the items depending on them are processed.
+// It returns the items found in checkout, for pruning, and an error if pass could not complete
+func syncPass(ns string, gitDir string, defaultImage string, changes *changeSet, items catalog, run *SyncRun) (gitItems, error) {
+	foundRecipes := make(map[string]terraModel.Recipe)
+
+	if changes.full() {
+		for _, kind := range catalogKinds {
+			items[kind] = make(map[string]catalogNode)
+			if err := items.scan(gitDir, kind); err != nil {
+				log.Error().Msgf("failed to search %s: %s", catalogDirs[kind], err)
+				return gitItems{}, fmt.Errorf("failed to search %s: %s", catalogDirs[kind], err)
+			}
+		}
+	} else {
+		for _, kind := range catalogKinds {
+			for key := range changes.items(kind) {
+				items.update(gitDir, kind, key)
+			}
+		}
+		// Items depending on changed recipes and templates must be processed too
+		changes.addDependents(items)
+	}
+	found := items.found(gitDir)
+
+	// Items not processed in an incremental pass are unchanged, and already in db
+	var recipeLookup func(key string) (string, error)
+	var templateLookup func(key string) (string, error)
+	if !changes.full() {
+		recipeLookup = func(key string) (string, error) {
+			elts := strings.Split(key, "/")
+			if len(elts) != 2 || changes.has(kindRecipe, key) {
+				return "", fmt.Errorf("recipe %s not injected", key)
+			}
+			recipe, _, err := getRecipe(ns, elts[0], elts[1])
+			if err != nil {
+				return "", err
+			}
+			return recipe.ID.Hex(), nil
+		}
+		templateLookup = func(key string) (string, error) {
+			elts := strings.Split(key, "/")
+			if len(elts) != 2 || changes.has(kindTemplate, key) {
+				return "", fmt.Errorf("template %s not injected", key)
+			}
+			template, _, err := getTemplate(ns, elts[0], elts[1])
+			if err != nil {
+				return "", err
+			}
+			return template.ID.Hex(), nil
+		}
+	}
+	createdRecipes := newIDIndex(recipeLookup)
+	createdTemplates := newIDIndex(templateLookup)
+
+	recipeDefs := loadRecipes(gitDir, items.files(gitDir, kindRecipe, changes), run)
+	parents := items.parents(gitDir)
+	for key := range parents {
+		// Invalid recipes are not injected, nor their children
+		if _, ok := recipeDefs[key]; !ok && changes.has(kindRecipe, key) {
+			delete(parents, key)
+		}
+	}
+
+	recipeOrder, orderErrs := terraGitModel.SortRecipes(parents)
+	for key, orderErr := range orderErrs {
+		log.Error().Str("recipe", key).Msgf("Recipe cannot be injected: %s", orderErr)
+		if changes.has(kindRecipe, key) {
+			run.fail(kindRecipe, recipeDefs[key].Recipe.Path, orderErr)
+		}
+	}
+	for _, key := range recipeOrder {
+		elts := strings.Split(key, "/")
+		name := elts[0]
+		version := elts[1]
+		tmpRecipe := terraModel.Recipe{
+			Remote:        name,
+			RemoteVersion: version,
+			BaseImages:    items[kindRecipe][key].Base,
+			ParentRecipe:  parents[key],
+		}
+		if !changes.has(kindRecipe, key) {
+			foundRecipes[key] = tmpRecipe
+			continue
+		}
+		t := recipeDefs[key]
+		injectErr := injectRecipe(ns, gitDir, name, version, t, createdRecipes, run)
+		if injectErr != nil {
+			log.Error().Str("recipe", name).Str("version", version).Msgf("Recipe not injected: %s", injectErr)
+			run.fail(kindRecipe, t.Recipe.Path, injectErr)
+			continue
+		}
+		foundRecipes[key] = tmpRecipe
+	}
+
+	for _, file := range items.files(gitDir, kindTemplate, changes) {
+		elts := strings.Split(file, "/")
+		name := elts[len(elts)-3]
+		version := elts[len(elts)-2]
+		t, loadErr := loadTemplate(file)
+		if loadErr != nil {
+			run.fail(kindTemplate, file, loadErr)
+			continue
+		}
+		injectErr := injectTemplate(ns, gitDir, name, version, t, createdTemplates, run)
+		if injectErr != nil {
+			log.Error().Str("template", name).Str("version", version).Msgf("Template not injected: %s", injectErr)
+			run.fail(kindTemplate, file, injectErr)
+		}
+	}
+
+	for _, file := range items.files(gitDir, kindEndpoint, changes) {
+		elts := strings.Split(file, "/")
+		name := elts[len(elts)-2]
+		t, loadErr := loadEndpoint(file)
+		if loadErr != nil {
+			run.fail(kindEndpoint, file, loadErr)
+			continue
+		}
+		injectErr := injectEndpoint(ns, name, t, run)
+		if injectErr != nil {
+			log.Error().Str("endpoint", name).Msgf("Endpoint not injected: %s", injectErr)
+			run.fail(kindEndpoint, file, injectErr)
+		}
+	}
+
+	for _, file := range items.files(gitDir, kindApplication, changes) {
+		elts := strings.Split(file, "/")
+		name := elts[len(elts)-3]
+		version := elts[len(elts)-2]
+		t, expectedRecipes, loadErr := loadApplication(gitDir, file)
+		if loadErr != nil {
+			run.fail(kindApplication, file, loadErr)
+			continue
+		}
+		appRecipes := make([]terraModel.Recipe, 0)
+		for _, expectedRecipe := range expectedRecipes {
+			appRecipes = append(appRecipes, foundRecipes[expectedRecipe])
+		}
+
+		var baseImages []string
+		var baseErr error
+		if len(t.Application.Recipes) == 0 && defaultImage != "" {
+			baseImages = make([]string, 1)
+			baseImages[0] = defaultImage
+		} else {
+			baseImages, baseErr = t.Application.GetAppBaseImages(appRecipes, foundRecipes)
+			if baseErr != nil {
+				log.Error().Msgf("Application %s could not find a base image between recipes", t.Application.Path)
+				run.fail(kindApplication, file, baseErr)
+				continue
+			}
+		}
+		log.Debug().Msgf("Base images: %+v", baseImages)
+
+		injectErr := injectApplication(ns, name, version, t, baseImages, createdTemplates, createdRecipes, run)
+		if injectErr != nil {
+			log.Error().Str("application", name).Str("version", version).Msgf("Application not injected: %s", injectErr)
+			run.fail(kindApplication, file, injectErr)
+		}
+	}
+
+	return found, nil
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Planned actions, in addition to sync actions
+const (
+	actionUnchanged = "unchanged"
+	actionInvalid   = "invalid"
+	actionDeprecate = "deprecate"
+	actionDelete    = "delete"
+)
+
+// planSymbols are the terraform-like prefixes of planned actions
+var planSymbols = map[string]string{
+	actionCreated:   "+",
+	actionUpdated:   "~",
+	actionUnchanged: "=",
+	actionFrozen:    "*",
+	actionInvalid:   "!",
+	actionDeprecate: "-",
+	actionDelete:    "-",
+}
+
+// planKinds is the display order of kinds
+var planKinds = []string{kindRecipe, kindTemplate, kindEndpoint, kindApplication}
+
+// PlanItem is an action the injector would do on an item
+type PlanItem struct {
+	Kind    string
+	Key     string
+	Action  string
+	Message string
+}
+
+// Plan lists the actions of a dry run pass
+type Plan struct {
+	Items []PlanItem
+}
+
+// add records an action in plan
+func (p *Plan) add(kind string, key string, action string, message string) {
+	p.Items = append(p.Items, PlanItem{Kind: kind, Key: key, Action: action, Message: message})
+}
+
+// Print writes plan, terraform style, to w
+func (p *Plan) Print(w io.Writer) {
+	total := make(map[string]int)
+	for _, kind := range planKinds {
+		items := make([]PlanItem, 0)
+		for _, item := range p.Items {
+			if item.Kind == kind {
+				items = append(items, item)
+			}
+		}
+		if len(items) == 0 {
+			continue
+		}
+		sort.SliceStable(items, func(i, j int) bool {
+			return items[i].Key < items[j].Key
+		})
+		fmt.Fprintf(w, "%ss:\n", kind)
+		for _, item := range items {
+			total[item.Action]++
+			if item.Message != "" {
+				fmt.Fprintf(w, "  %s %s (%s: %s)\n", planSymbols[item.Action], item.Key, item.Action, item.Message)
+			} else {
+				fmt.Fprintf(w, "  %s %s (%s)\n", planSymbols[item.Action], item.Key, item.Action)
+			}
+		}
+		fmt.Fprintln(w)
+	}
+	fmt.Fprintf(w, "Plan: %d to create, %d to update, %d unchanged, %d frozen, %d invalid, %d to deprecate, %d to delete.\n",
+		total[actionCreated], total[actionUpdated], total[actionUnchanged], total[actionFrozen],
+		total[actionInvalid], total[actionDeprecate], total[actionDelete])
+}
+
+// dryRun tells if pass must only record its actions in plan
+func (run *SyncRun) dryRun() bool {
+	return run.plan != nil
+}
+
+// planned records the action on an existing (or not) document, changed or not, in dry run plan
+func (run *SyncRun) planned(kind string, key string, exists bool, changed bool) {
+	action := actionCreated
+	if exists {
+		action = actionUpdated
+		if !changed {
+			action = actionUnchanged
+		}
+	}
+	run.record(kind, key, action)
+}
+
+// plannedID returns the id to reference a document in dry run, a placeholder for new ones
+func plannedID(id string, key string) string {
+	if id == "" || id == "000000000000000000000000" {
+		return "new:" + key
+	}
+	return id
+}
+
+// planInjection runs a dry run pass on source and prints what injector would do
+func planInjection(source Source, defaultImage string) error {
+	repo, err := openRepository(source)
+	if err != nil {
+		return fmt.Errorf("failed to get git repository: %s", err)
+	}
+	commit, err := updateRepository(repo, source)
+	if err != nil {
+		return fmt.Errorf("failed to update files: %s", err)
+	}
+
+	ns, nsErr := findNS(source.Namespace)
+	if nsErr != nil {
+		log.Info().Str("source", source.Name).Msgf("Namespace %s does not exist yet, all items will be created", source.Namespace)
+		ns = ""
+	}
+
+	run := &SyncRun{
+		Source: source.Name,
+		public: source.Public,
+		Start:  time.Now().Unix(),
+		Status: runRunning,
+		Counts: make(map[string]*SyncCounts),
+		Errors: make([]SyncError, 0),
+		Commit: commit,
+		plan:   &Plan{},
+	}
+	found, syncErr := syncPass(ns, source.Dir, defaultImage, nil, newCatalog(nil), run)
+	if syncErr != nil {
+		return syncErr
+	}
+	if ns != "" {
+		if pruneErr := prune(ns, injectorConfig.Prune, found, run.plan); pruneErr != nil {
+			return pruneErr
+		}
+	}
+
+	fmt.Printf("Injection plan for source %s (namespace %s), commit %s\n\n", source.Name, source.Namespace, run.Commit)
+	run.plan.Print(os.Stdout)
+	return nil
+}
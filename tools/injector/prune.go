@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	mongo "go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/rs/zerolog/log"
+
+	terraModel "github.com/osallou/goterra-lib/lib/model"
+)
+
+// gitItems lists the items found in git checkout during a pass, keyed by name/version (name for endpoints)
+//
+// A nil map means kind could not be scanned, and must not be pruned
+type gitItems struct {
+	recipes   map[string]bool
+	templates map[string]bool
+	endpoints map[string]bool
+	apps      map[string]bool
+}
+
+// remoteDocument is the subset of an injected document needed for pruning
+type remoteDocument struct {
+	ID            primitive.ObjectID `bson:"_id"`
+	Remote        string             `bson:"remote"`
+	RemoteVersion string             `bson:"remoteversion"`
+	Frozen        bool               `bson:"frozen"`
+	Deprecated    bool               `bson:"deprecated"`
+}
+
+// key returns the git key of document, as used in gitItems
+func (d remoteDocument) key() string {
+	if d.RemoteVersion == "" {
+		return d.Remote
+	}
+	return d.Remote + "/" + d.RemoteVersion
+}
+
+// usedItems returns ids of templates and recipes still referenced by an application (any namespace)
+// or, for recipes, used as parent by an other recipe
+//
+// Applications in deleted, planned for deletion, do not count
+func usedItems(deleted map[string]bool) (map[string]bool, map[string]bool, error) {
+	usedTemplates := make(map[string]bool)
+	usedRecipes := make(map[string]bool)
+
+	appCtx, appCancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer appCancel()
+	cursor, err := appCollection.Find(appCtx, bson.M{})
+	if err != nil {
+		return nil, nil, err
+	}
+	for cursor.Next(appCtx) {
+		var app terraModel.Application
+		if decodeErr := cursor.Decode(&app); decodeErr != nil {
+			cursor.Close(appCtx)
+			return nil, nil, decodeErr
+		}
+		if deleted[app.ID.Hex()] {
+			continue
+		}
+		usedTemplates[app.Template] = true
+		for _, recipes := range app.TemplateRecipes {
+			for _, recipe := range recipes {
+				usedRecipes[recipe] = true
+			}
+		}
+	}
+	cursor.Close(appCtx)
+
+	recipeCtx, recipeCancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer recipeCancel()
+	cursor, err = recipeCollection.Find(recipeCtx, bson.M{"parentrecipe": bson.M{"$ne": ""}})
+	if err != nil {
+		return nil, nil, err
+	}
+	defer cursor.Close(recipeCtx)
+	for cursor.Next(recipeCtx) {
+		var recipe terraModel.Recipe
+		if decodeErr := cursor.Decode(&recipe); decodeErr != nil {
+			return nil, nil, decodeErr
+		}
+		usedRecipes[recipe.ParentRecipe] = true
+	}
+
+	return usedTemplates, usedRecipes, nil
+}
+
+// pruneAction returns the action to apply to a document removed from git: frozen, delete, deprecate
+// or empty if document is already deprecated
+//
+// Frozen documents are never modified, documents in used are deprecated instead of deleted.
+func pruneAction(doc remoteDocument, policy string, used map[string]bool) string {
+	if doc.Frozen {
+		return actionFrozen
+	}
+	if policy == PruneDelete && !used[doc.ID.Hex()] {
+		return actionDelete
+	}
+	if doc.Deprecated {
+		return ""
+	}
+	return actionDeprecate
+}
+
+// removedDocuments returns the documents of namespace whose source is not in found anymore
+func removedDocuments(collection *mongo.Collection, kind string, ns string, found map[string]bool) ([]remoteDocument, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	req := bson.M{
+		"namespace": ns,
+		"remote":    bson.M{"$exists": true, "$ne": ""},
+	}
+	cursor, err := collection.Find(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	removed := make([]remoteDocument, 0)
+	for cursor.Next(ctx) {
+		var doc remoteDocument
+		if decodeErr := cursor.Decode(&doc); decodeErr != nil {
+			log.Error().Str("kind", kind).Msgf("Failed to decode document: %s", decodeErr)
+			continue
+		}
+		if !found[doc.key()] {
+			removed = append(removed, doc)
+		}
+	}
+	return removed, nil
+}
+
+// deleteDocument deletes a pruned document
+func deleteDocument(collection *mongo.Collection, doc remoteDocument) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	_, err := collection.DeleteOne(ctx, bson.M{"_id": doc.ID})
+	return err
+}
+
+// deprecateDocument deprecates a pruned document and hides it
+func deprecateDocument(collection *mongo.Collection, doc remoteDocument) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	update := bson.M{
+		"$set": bson.M{
+			"deprecated": true,
+			"public":     false,
+		},
+	}
+	_, err := collection.UpdateOne(ctx, bson.M{"_id": doc.ID}, update)
+	return err
+}
+
+// pruneCollection deprecates or deletes documents of namespace whose source is not in found anymore
+//
+// See pruneAction for the action applied to each document.
+// If plan is not nil, actions are only recorded in plan.
+// Returns the ids of deleted documents, or planned for deletion
+func pruneCollection(collection *mongo.Collection, kind string, ns string, policy string, found map[string]bool, used map[string]bool, plan *Plan) map[string]bool {
+	deleted := make(map[string]bool)
+	if found == nil || policy == PruneNone {
+		return deleted
+	}
+	removed, err := removedDocuments(collection, kind, ns, found)
+	if err != nil {
+		log.Error().Str("kind", kind).Msgf("Failed to search documents to prune: %s", err)
+		return deleted
+	}
+
+	for _, doc := range removed {
+		action := pruneAction(doc, policy, used)
+		if action == "" {
+			continue
+		}
+		if plan != nil {
+			plan.add(kind, doc.key(), action, "removed from git")
+			if action == actionDelete {
+				deleted[doc.ID.Hex()] = true
+			}
+			continue
+		}
+		switch action {
+		case actionFrozen:
+			log.Info().Str("kind", kind).Str("remote", doc.key()).Msg("Removed from git but frozen, keeping it")
+		case actionDelete:
+			log.Info().Str("kind", kind).Str("remote", doc.key()).Msg("Removed from git, deleting")
+			if err := deleteDocument(collection, doc); err != nil {
+				log.Error().Str("kind", kind).Msgf("Failed to delete %s: %s", doc.key(), err)
+				continue
+			}
+			deleted[doc.ID.Hex()] = true
+		case actionDeprecate:
+			if policy == PruneDelete {
+				log.Info().Str("kind", kind).Str("remote", doc.key()).Msg("Removed from git but still in use, deprecating")
+			} else {
+				log.Info().Str("kind", kind).Str("remote", doc.key()).Msg("Removed from git, deprecating")
+			}
+			if err := deprecateDocument(collection, doc); err != nil {
+				log.Error().Str("kind", kind).Msgf("Failed to deprecate %s: %s", doc.key(), err)
+			}
+		}
+	}
+	return deleted
+}
+
+// prune reconciles namespace documents with the items found in git, or only plans it if plan is not nil
+func prune(ns string, policy string, found gitItems, plan *Plan) error {
+	if policy == PruneNone {
+		return nil
+	}
+	// Applications first, so that removed apps do not protect their recipes and templates
+	deletedApps := pruneCollection(appCollection, "application", ns, policy, found.apps, nil, plan)
+
+	usedTemplates, usedRecipes, err := usedItems(deletedApps)
+	if err != nil {
+		return fmt.Errorf("failed to get used templates and recipes: %s", err)
+	}
+	pruneCollection(templateCollection, "template", ns, policy, found.templates, usedTemplates, plan)
+	pruneCollection(recipeCollection, "recipe", ns, policy, found.recipes, usedRecipes, plan)
+	pruneCollection(endpointCollection, "endpoint", ns, policy, found.endpoints, nil, plan)
+	return nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestRemoteDocumentKey(t *testing.T) {
+	if key := (remoteDocument{Remote: "app", RemoteVersion: "v1.0"}).key(); key != "app/v1.0" {
+		t.Errorf("key = %s, want app/v1.0", key)
+	}
+	if key := (remoteDocument{Remote: "cloud"}).key(); key != "cloud" {
+		t.Errorf("key = %s, want cloud", key)
+	}
+}
+
+func TestPruneAction(t *testing.T) {
+	id := primitive.NewObjectID()
+	used := map[string]bool{id.Hex(): true}
+
+	tests := []struct {
+		name   string
+		doc    remoteDocument
+		policy string
+		used   map[string]bool
+		want   string
+	}{
+		{name: "deprecate", doc: remoteDocument{ID: id}, policy: PruneDeprecate, want: actionDeprecate},
+		{name: "deprecate used", doc: remoteDocument{ID: id}, policy: PruneDeprecate, used: used, want: actionDeprecate},
+		{name: "deprecate already deprecated", doc: remoteDocument{ID: id, Deprecated: true}, policy: PruneDeprecate, want: ""},
+		{name: "deprecate frozen", doc: remoteDocument{ID: id, Frozen: true}, policy: PruneDeprecate, want: actionFrozen},
+		{name: "delete", doc: remoteDocument{ID: id}, policy: PruneDelete, want: actionDelete},
+		{name: "delete deprecated", doc: remoteDocument{ID: id, Deprecated: true}, policy: PruneDelete, want: actionDelete},
+		{name: "delete used", doc: remoteDocument{ID: id}, policy: PruneDelete, used: used, want: actionDeprecate},
+		{name: "delete used already deprecated", doc: remoteDocument{ID: id, Deprecated: true}, policy: PruneDelete, used: used, want: ""},
+		{name: "delete frozen", doc: remoteDocument{ID: id, Frozen: true}, policy: PruneDelete, want: actionFrozen},
+		{name: "delete frozen used", doc: remoteDocument{ID: id, Frozen: true}, policy: PruneDelete, used: used, want: actionFrozen},
+	}
+	for _, test := range tests {
+		if got := pruneAction(test.doc, test.policy, test.used); got != test.want {
+			t.Errorf("%s: action = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestPruneNone(t *testing.T) {
+	// Nothing is read from database, collections are never used
+	found := map[string]bool{}
+	if deleted := pruneCollection(nil, "recipe", "ns", PruneNone, found, nil, nil); len(deleted) != 0 {
+		t.Errorf("none policy deleted %v", deleted)
+	}
+	if deleted := pruneCollection(nil, "recipe", "ns", PruneDelete, nil, nil, nil); len(deleted) != 0 {
+		t.Errorf("unscanned kind deleted %v", deleted)
+	}
+	plan := &Plan{}
+	if err := prune("ns", PruneNone, gitItems{}, plan); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// maxRuns is the number of passes kept in history
+const maxRuns = 50
+
+// Sync actions counted per kind in a SyncRun
+const (
+	actionCreated = "created"
+	actionUpdated = "updated"
+	actionSkipped = "skipped"
+	actionFrozen  = "frozen"
+)
+
+// Sync run status
+const (
+	runRunning = "running"
+	runOk      = "ok"
+	runFailed  = "failed"
+)
+
+// SyncCounts counts items per action for a kind
+type SyncCounts struct {
+	Created   int `json:"created"`
+	Updated   int `json:"updated"`
+	Skipped   int `json:"skipped"`
+	Frozen    int `json:"frozen"`
+	Unchanged int `json:"unchanged"`
+}
+
+// SyncError is an error on a file during a pass
+type SyncError struct {
+	Kind    string `json:"kind"`
+	File    string `json:"file"`
+	Message string `json:"message"`
+}
+
+// SyncRun describes an injector pass
+type SyncRun struct {
+	ID     int                    `json:"id"`
+	Source string                 `json:"source"`
+	Commit string                 `json:"commit"`
+	Start  int64                  `json:"start"`
+	End    int64                  `json:"end"`
+	Status string                 `json:"status"`
+	Error  string                 `json:"error,omitempty"`
+	Counts map[string]*SyncCounts `json:"counts"`
+	Errors []SyncError            `json:"errors"`
+
+	// public tells if injected documents are public
+	public bool
+	// plan records actions instead of doing them, in dry run mode
+	plan *Plan
+}
+
+// runsLock protects runs history and the current run
+var runsLock sync.Mutex
+var runs = make([]*SyncRun, 0)
+var lastRunID = 0
+
+// newRun starts a new pass of source and records it in history
+func newRun(source Source) *SyncRun {
+	runsLock.Lock()
+	defer runsLock.Unlock()
+	lastRunID++
+	run := &SyncRun{
+		ID:     lastRunID,
+		Source: source.Name,
+		public: source.Public,
+		Start:  time.Now().Unix(),
+		Status: runRunning,
+		Counts: make(map[string]*SyncCounts),
+		Errors: make([]SyncError, 0),
+	}
+	runs = append(runs, run)
+	if len(runs) > maxRuns {
+		runs = runs[len(runs)-maxRuns:]
+	}
+	return run
+}
+
+// setCommit records the commit used by the pass
+func (run *SyncRun) setCommit(commit string) {
+	runsLock.Lock()
+	defer runsLock.Unlock()
+	run.Commit = commit
+}
+
+// count increments action counter of kind
+func (run *SyncRun) count(kind string, action string) {
+	runsLock.Lock()
+	defer runsLock.Unlock()
+	counts, ok := run.Counts[kind]
+	if !ok {
+		counts = &SyncCounts{}
+		run.Counts[kind] = counts
+	}
+	switch action {
+	case actionCreated:
+		counts.Created++
+	case actionUpdated:
+		counts.Updated++
+	case actionSkipped:
+		counts.Skipped++
+	case actionFrozen:
+		counts.Frozen++
+	case actionUnchanged:
+		counts.Unchanged++
+	}
+}
+
+// record counts action on item of kind, and adds it to plan in dry run mode
+func (run *SyncRun) record(kind string, key string, action string) {
+	run.count(kind, action)
+	if run.plan != nil {
+		run.plan.add(kind, key, action, "")
+	}
+}
+
+// fail records an error on file, and counts it as skipped
+func (run *SyncRun) fail(kind string, file string, err error) {
+	run.count(kind, actionSkipped)
+	runsLock.Lock()
+	defer runsLock.Unlock()
+	run.Errors = append(run.Errors, SyncError{Kind: kind, File: file, Message: err.Error()})
+	if run.plan != nil {
+		run.plan.add(kind, file, actionInvalid, err.Error())
+	}
+}
+
+// failedFiles returns the paths, relative to dir, of the files with an error
+func (run *SyncRun) failedFiles(dir string) []string {
+	runsLock.Lock()
+	defer runsLock.Unlock()
+	files := make([]string, 0, len(run.Errors))
+	for _, e := range run.Errors {
+		file, err := filepath.Rel(dir, e.File)
+		if err != nil {
+			continue
+		}
+		files = append(files, filepath.ToSlash(file))
+	}
+	return files
+}
+
+// finish ends the pass, with error if it could not complete
+func (run *SyncRun) finish(err error) {
+	runsLock.Lock()
+	defer runsLock.Unlock()
+	run.End = time.Now().Unix()
+	run.Status = runOk
+	if err != nil {
+		run.Status = runFailed
+		run.Error = err.Error()
+	}
+}
+
+// SourceStatus is the sync status of a source
+type SourceStatus struct {
+	Current *SyncRun `json:"current"`
+	Last    *SyncRun `json:"last"`
+}
+
+// StatusHandler returns current and last completed injector passes of each source
+var StatusHandler = func(w http.ResponseWriter, r *http.Request) {
+	runsLock.Lock()
+	defer runsLock.Unlock()
+	sources := make(map[string]*SourceStatus)
+	for _, source := range injectorConfig.Sources {
+		sources[source.Name] = &SourceStatus{}
+	}
+	for i := len(runs) - 1; i >= 0; i-- {
+		status, ok := sources[runs[i].Source]
+		if !ok {
+			continue
+		}
+		if runs[i].Status == runRunning {
+			if status.Current == nil && status.Last == nil {
+				status.Current = runs[i]
+			}
+			continue
+		}
+		if status.Last == nil {
+			status.Last = runs[i]
+		}
+	}
+	resp := map[string]interface{}{"version": Version, "sources": sources}
+	w.Header().Add("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// RunsHandler returns injector passes history, most recent first
+var RunsHandler = func(w http.ResponseWriter, r *http.Request) {
+	runsLock.Lock()
+	defer runsLock.Unlock()
+	history := make([]*SyncRun, 0, len(runs))
+	for i := len(runs) - 1; i >= 0; i-- {
+		history = append(history, runs[i])
+	}
+	resp := map[string]interface{}{"runs": history}
+	w.Header().Add("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// diffContext is the number of unchanged lines around changes
+const diffContext = 3
+
+// diffLine is a line of a diff, op is ' ', '-' or '+'
+type diffLine struct {
+	op   byte
+	text string
+}
+
+// diffLines computes the line diff of a and b (longest common subsequence)
+func diffLines(a []string, b []string) []diffLine {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	lines := make([]diffLine, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			lines = append(lines, diffLine{' ', a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			lines = append(lines, diffLine{'-', a[i]})
+			i++
+		default:
+			lines = append(lines, diffLine{'+', b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		lines = append(lines, diffLine{'-', a[i]})
+	}
+	for ; j < len(b); j++ {
+		lines = append(lines, diffLine{'+', b[j]})
+	}
+	return lines
+}
+
+// splitLines splits text in lines, without the final empty line
+func splitLines(text string) []string {
+	if text == "" {
+		return []string{}
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
+
+// unifiedDiff returns the unified diff of file from before to after, empty if equal
+func unifiedDiff(file string, before string, after string) string {
+	lines := diffLines(splitLines(before), splitLines(after))
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- a/%s\n+++ b/%s\n", file, file)
+	changed := false
+	for start := 0; start < len(lines); {
+		// Next change
+		first := start
+		for first < len(lines) && lines[first].op == ' ' {
+			first++
+		}
+		if first == len(lines) {
+			break
+		}
+		changed = true
+		// Hunk spans changes separated by less than 2*diffContext unchanged lines
+		last := first
+		for k := first; k < len(lines); k++ {
+			if lines[k].op != ' ' {
+				last = k
+			} else if k-last > 2*diffContext {
+				break
+			}
+		}
+		from := first - diffContext
+		if from < start {
+			from = start
+		}
+		to := last + diffContext + 1
+		if to > len(lines) {
+			to = len(lines)
+		}
+
+		// Line numbers of hunk start in before and after
+		oldLine, newLine := 1, 1
+		for _, line := range lines[:from] {
+			if line.op != '+' {
+				oldLine++
+			}
+			if line.op != '-' {
+				newLine++
+			}
+		}
+		oldCount, newCount := 0, 0
+		for _, line := range lines[from:to] {
+			if line.op != '+' {
+				oldCount++
+			}
+			if line.op != '-' {
+				newCount++
+			}
+		}
+		fmt.Fprintf(&out, "@@ -%d,%d +%d,%d @@\n", oldLine, oldCount, newLine, newCount)
+		for _, line := range lines[from:to] {
+			fmt.Fprintf(&out, "%c%s\n", line.op, line.text)
+		}
+		start = to
+	}
+	if !changed {
+		return ""
+	}
+	return out.String()
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// fixKinds maps definition files to their kind
+var fixKinds = map[string]string{
+	"recipe.yaml":   kindRecipe,
+	"template.yaml": kindTemplate,
+	"endpoint.yaml": kindEndpoint,
+	"app.yaml":      kindApplication,
+}
+
+// uniqueSequences are the keys whose sequence value must not have duplicates
+var uniqueSequences = map[string]bool{
+	"tags": true,
+	"base": true,
+}
+
+// emptyValues are the keys whose null value is replaced by an empty value
+var emptyValues = map[string]string{
+	"inputs": "{}",
+	"tags":   "[]",
+}
+
+// root keys of definitions, per kind
+var rootKeys = map[string]string{
+	kindRecipe:      "recipe",
+	kindTemplate:    "template",
+	kindEndpoint:    "endpoint",
+	kindApplication: "application",
+}
+
+// isNull tells if node is a null scalar
+func isNull(node *yamlv3.Node) bool {
+	return node.Kind == yamlv3.ScalarNode && node.Tag == "!!null"
+}
+
+// lineEdit replaces a line of file (0 based) by text lines, removing it if text is empty,
+// or inserts text lines after it
+type lineEdit struct {
+	line  int
+	after bool
+	text  []string
+}
+
+// lineComment returns the comment at end of line of key or of its value, with its leading space
+func lineComment(key *yamlv3.Node, value *yamlv3.Node) string {
+	for _, comment := range []string{key.LineComment, value.LineComment} {
+		if comment != "" {
+			return " " + comment
+		}
+	}
+	return ""
+}
+
+// scalarText returns the text of a scalar in its original style
+func scalarText(node *yamlv3.Node) string {
+	switch {
+	case node.Style&yamlv3.DoubleQuotedStyle != 0:
+		return strconv.Quote(node.Value)
+	case node.Style&yamlv3.SingleQuotedStyle != 0:
+		return "'" + strings.Replace(node.Value, "'", "''", -1) + "'"
+	}
+	return node.Value
+}
+
+// fixMapping returns the edits of file lines fixing the mechanical issues of definition mapping def,
+// whose last line is end: null or empty parent is removed, null inputs and tags are set empty,
+// duplicates of tags and base are removed and missing tags are added
+//
+// Only the lines of fixed keys are changed, other keys keep their order, indentation and comments
+func fixMapping(def *yamlv3.Node, lines []string, end int) []lineEdit {
+	edits := make([]lineEdit, 0)
+	if def.Style&yamlv3.FlowStyle != 0 || len(def.Content) == 0 {
+		return edits
+	}
+	indent := strings.Repeat(" ", def.Content[0].Column-1)
+	hasTags := false
+	for i := 0; i+1 < len(def.Content); i += 2 {
+		key, value := def.Content[i], def.Content[i+1]
+		line := key.Line - 1
+		if key.Value == "tags" {
+			hasTags = true
+		}
+		switch {
+		case key.Value == "parent" && value.Kind == yamlv3.ScalarNode && (isNull(value) || value.Value == "") && value.Line == key.Line:
+			// No parent
+			edits = append(edits, lineEdit{line: line})
+		case emptyValues[key.Value] != "" && isNull(value) && value.Line == key.Line:
+			colon := strings.Index(lines[line][key.Column-1:], ":")
+			if colon < 0 {
+				continue
+			}
+			prefix := lines[line][:key.Column+colon]
+			edits = append(edits, lineEdit{line: line, text: []string{prefix + " " + emptyValues[key.Value] + lineComment(key, value)}})
+		case uniqueSequences[key.Value] && value.Kind == yamlv3.SequenceNode:
+			edits = append(edits, removeDuplicates(key, value, lines)...)
+		}
+	}
+	if !hasTags {
+		edits = append(edits, lineEdit{line: end, after: true, text: []string{indent + "tags: []"}})
+	}
+	return edits
+}
+
+// removeDuplicates returns the edits removing duplicate scalars of sequence value of key
+func removeDuplicates(key *yamlv3.Node, value *yamlv3.Node, lines []string) []lineEdit {
+	edits := make([]lineEdit, 0)
+	seen := make(map[string]bool)
+	items := make([]string, 0, len(value.Content))
+	duplicates := false
+	for _, item := range value.Content {
+		if item.Kind != yamlv3.ScalarNode {
+			// Only sequences of scalars are fixed
+			return []lineEdit{}
+		}
+		if seen[item.Value] {
+			duplicates = true
+			if value.Style&yamlv3.FlowStyle == 0 {
+				edits = append(edits, lineEdit{line: item.Line - 1})
+			}
+			continue
+		}
+		seen[item.Value] = true
+		items = append(items, scalarText(item))
+	}
+	if !duplicates || value.Style&yamlv3.FlowStyle == 0 {
+		return edits
+	}
+	// Flow sequence is rewritten if it is on a single line, with nothing after it but a comment
+	for _, item := range value.Content {
+		if item.Line != value.Line {
+			return []lineEdit{}
+		}
+	}
+	line := lines[value.Line-1]
+	rest := strings.TrimSpace(line[value.Column-1:])
+	if comment := lineComment(key, value); comment != "" {
+		rest = strings.TrimSpace(strings.TrimSuffix(rest, strings.TrimSpace(comment)))
+	}
+	if !strings.HasSuffix(rest, "]") {
+		return []lineEdit{}
+	}
+	fixed := line[:value.Column-1] + "[" + strings.Join(items, ", ") + "]" + lineComment(key, value)
+	return []lineEdit{{line: value.Line - 1, text: []string{fixed}}}
+}
+
+// applyEdits returns lines with edits applied
+func applyEdits(lines []string, edits []lineEdit) []string {
+	// From last line, inserts after a line before its replacement, to keep line numbers
+	sort.SliceStable(edits, func(i, j int) bool {
+		if edits[i].line != edits[j].line {
+			return edits[i].line > edits[j].line
+		}
+		return edits[i].after && !edits[j].after
+	})
+	for _, edit := range edits {
+		tail := append([]string{}, lines[edit.line+1:]...)
+		if edit.after {
+			lines = append(append(lines[:edit.line+1], edit.text...), tail...)
+		} else {
+			lines = append(append(lines[:edit.line], edit.text...), tail...)
+		}
+	}
+	return lines
+}
+
+// fixDefinition returns definition file of kind with its mechanical issues fixed
+func fixDefinition(kind string, data []byte) ([]byte, error) {
+	var doc yamlv3.Node
+	if err := yamlv3.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if doc.Kind != yamlv3.DocumentNode || len(doc.Content) == 0 || doc.Content[0].Kind != yamlv3.MappingNode {
+		return nil, fmt.Errorf("not a %s definition", kind)
+	}
+	lines := strings.Split(string(data), "\n")
+	root := doc.Content[0]
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value != rootKeys[kind] || root.Content[i+1].Kind != yamlv3.MappingNode {
+			continue
+		}
+		// Definition ends before next root key, without trailing blank and comment lines
+		end := len(lines) - 1
+		if i+2 < len(root.Content) {
+			end = root.Content[i+2].Line - 2
+		}
+		for end > root.Content[i].Line-1 && (strings.TrimSpace(lines[end]) == "" || strings.HasPrefix(strings.TrimSpace(lines[end]), "#")) {
+			end--
+		}
+		edits := fixMapping(root.Content[i+1], lines, end)
+		return []byte(strings.Join(applyEdits(lines, edits), "\n")), nil
+	}
+	return nil, fmt.Errorf("missing %s section", rootKeys[kind])
+}
+
+// fixFiles fixes the mechanical issues of the definition files of targetDir, and prints a diff
+// of changed files to report output (stderr if report is not text)
+func fixFiles(report *Report, targetDir string) error {
+	out := report.out
+	if report.Format != formatText {
+		out = os.Stderr
+	}
+	names := make([]string, 0, len(fixKinds))
+	for name := range fixKinds {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		files, err := findFiles(targetDir, name)
+		if err != nil {
+			return err
+		}
+		for _, f := range files {
+			data, err := ioutil.ReadFile(f)
+			if err != nil {
+				return err
+			}
+			fixed, fixErr := fixDefinition(fixKinds[name], data)
+			if fixErr != nil {
+				// Reported by checks
+				fmt.Fprintf(out, "Fix:%s:skipped: %s\n", f, fixErr)
+				continue
+			}
+			if bytes.Equal(data, fixed) {
+				continue
+			}
+			info, err := os.Stat(f)
+			if err != nil {
+				return err
+			}
+			if err := ioutil.WriteFile(f, fixed, info.Mode()); err != nil {
+				return fmt.Errorf("failed to write %s: %s", f, err)
+			}
+			fmt.Fprint(out, unifiedDiff(f, string(data), string(fixed)))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fixTestKinds maps the prefix of test files to their definition kind
+var fixTestKinds = map[string]string{
+	"recipe":      kindRecipe,
+	"template":    kindTemplate,
+	"endpoint":    kindEndpoint,
+	"application": kindApplication,
+}
+
+func TestFixDefinition(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "fix", "*.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		name := strings.TrimSuffix(filepath.Base(file), ".yaml")
+		t.Run(name, func(t *testing.T) {
+			kind := fixTestKinds[strings.SplitN(name, "_", 2)[0]]
+			data, err := ioutil.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			fixed, err := fixDefinition(kind, data)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			base := strings.TrimSuffix(file, ".yaml")
+			golden(t, base+".golden", string(fixed))
+			golden(t, base+".diff", unifiedDiff(name+".yaml", string(data), string(fixed)))
+
+			// Fixed file has nothing left to fix
+			again, err := fixDefinition(kind, fixed)
+			if err != nil {
+				t.Fatalf("unexpected error on fixed file: %s", err)
+			}
+			if string(again) != string(fixed) {
+				t.Errorf("fix is not idempotent:\n%s", unifiedDiff(name+".yaml", string(fixed), string(again)))
+			}
+		})
+	}
+}
+
+func TestFixDefinitionErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{name: "invalid yaml", data: "recipe: [a"},
+		{name: "not a mapping", data: "- recipe"},
+		{name: "missing section", data: "template:\n  name: test\n"},
+	}
+	for _, test := range tests {
+		if _, err := fixDefinition(kindRecipe, []byte(test.data)); err == nil {
+			t.Errorf("%s: expected an error", test.name)
+		}
+	}
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	tests := []struct {
+		name   string
+		before string
+		after  string
+		want   string
+	}{
+		{name: "equal", before: "a\nb\n", after: "a\nb\n", want: ""},
+		{name: "added to empty", before: "", after: "a\n", want: "--- a/f\n+++ b/f\n@@ -1,0 +1,1 @@\n+a\n"},
+		{name: "removed", before: "a\nb\nc\n", after: "a\nc\n", want: "--- a/f\n+++ b/f\n@@ -1,3 +1,2 @@\n a\n-b\n c\n"},
+		{name: "changed", before: "a\nb\n", after: "a\nc\n", want: "--- a/f\n+++ b/f\n@@ -1,2 +1,2 @@\n a\n-b\n+c\n"},
+		{
+			name:   "two hunks",
+			before: "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n",
+			after:  "0\n1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n",
+			want:   "--- a/f\n+++ b/f\n@@ -1,3 +1,4 @@\n+0\n 1\n 2\n 3\n@@ -9,4 +10,3 @@\n 9\n 10\n 11\n-12\n",
+		},
+	}
+	for _, test := range tests {
+		if got := unifiedDiff("f", test.before, test.after); got != test.want {
+			t.Errorf("%s: diff = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
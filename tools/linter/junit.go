@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+)
+
+// junitSuites are the test suites of JUnit report, one per kind
+var junitSuites = []struct {
+	kind string
+	name string
+}{
+	{kindRecipe, "recipes"},
+	{kindTemplate, "templates"},
+	{kindEndpoint, "endpoints"},
+	{kindApplication, "applications"},
+}
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string         `xml:"name,attr"`
+	ClassName string         `xml:"classname,attr"`
+	Failures  []junitFailure `xml:"failure"`
+	SystemOut string         `xml:"system-out,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// junit converts checked files and their findings to JUnit test suites
+//
+// Errors are failures, other findings are reported in test case output. Findings on
+// other files of an item, like scripts, are reported in the test case of its definition
+func (r *Report) junit() junitTestSuites {
+	report := junitTestSuites{Name: "goterra-linter", Suites: make([]junitTestSuite, 0, len(junitSuites))}
+	for _, s := range junitSuites {
+		suite := junitTestSuite{Name: s.name, Cases: make([]junitTestCase, 0)}
+		for _, file := range r.Files {
+			if file.Kind != s.kind {
+				continue
+			}
+			testCase := junitTestCase{Name: file.File, ClassName: s.name}
+			for _, f := range r.Findings {
+				if r.owner(f.File) != file.File {
+					continue
+				}
+				location := f.position()
+				if f.Severity != severityError {
+					testCase.SystemOut += fmt.Sprintf("%s: %s: %s (%s)\n", location, f.Severity, f.text(), f.Rule)
+					continue
+				}
+				testCase.Failures = append(testCase.Failures, junitFailure{
+					Message: f.text(),
+					Type:    f.Rule,
+					Text:    fmt.Sprintf("%s: %s", location, f.text()),
+				})
+			}
+			suite.Tests++
+			if len(testCase.Failures) > 0 {
+				suite.Failures++
+			}
+			suite.Cases = append(suite.Cases, testCase)
+		}
+		report.Tests += suite.Tests
+		report.Failures += suite.Failures
+		report.Suites = append(report.Suites, suite)
+	}
+	return report
+}
+
+// WriteJUnit writes a JUnit XML report to file
+func (r *Report) WriteJUnit(file string) error {
+	out, err := os.Create(file)
+	if err != nil {
+		return fmt.Errorf("failed to create junit report %s: %s", file, err)
+	}
+	defer out.Close()
+	if _, err := out.WriteString(xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(out)
+	enc.Indent("", "  ")
+	if err := enc.Encode(r.junit()); err != nil {
+		return fmt.Errorf("failed to write junit report %s: %s", file, err)
+	}
+	_, err = out.WriteString("\n")
+	return err
+}
@@ -1,16 +1,17 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 
-	yaml "gopkg.in/yaml.v2"
-
 	terraGitModel "github.com/osallou/goterra-community/tools/model"
 	terraModel "github.com/osallou/goterra-lib/lib/model"
+	yaml "gopkg.in/yaml.v2"
 )
 
 func findFiles(targetDir string, pattern string) (files []string, err error) {
@@ -28,11 +29,52 @@ func findFiles(targetDir string, pattern string) (files []string, err error) {
 }
 
 func main() {
-	if len(os.Args) <= 1 {
-		fmt.Printf("USAGE : %s <target_directory>\n", os.Args[0])
+	if len(os.Args) > 1 && os.Args[1] == "matrix" {
+		os.Exit(matrixCommand(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "schema" {
+		os.Exit(schemaCommand(os.Args[2:]))
+	}
+
+	format := flag.String("format", formatText, "output format: text, json or sarif")
+	junitFile := flag.String("junit", "", "also write a JUnit XML report to file")
+	fix := flag.Bool("fix", false, "fix mechanical issues of definition files (null inputs and tags, duplicate tags, null parent) before checks, and print a diff")
+	since := flag.String("since", "", "only report on items changed since git ref (and items depending on them)")
+	flag.IntVar(&terraGitModel.MaxRecipeDepth, "max-depth", terraGitModel.MaxRecipeDepth, "max number of ancestors of a recipe, 0 for no limit")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "USAGE : %s [options] <target_directory>\n", os.Args[0])
+		fmt.Fprintf(flag.CommandLine.Output(), "        %s matrix [options] <target_directory>\n", os.Args[0])
+		fmt.Fprintf(flag.CommandLine.Output(), "        %s schema [options]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() < 1 {
+		flag.Usage()
+		os.Exit(1)
+	}
+	targetDirectory := flag.Arg(0)
+
+	report, err := NewReport(*format, os.Stdout)
+	if err != nil {
+		fmt.Printf("Error: %s\n", err)
 		os.Exit(1)
 	}
-	targetDirectory := os.Args[1]
+
+	if *since != "" {
+		scope, scopeErr := sinceScope(targetDirectory, *since)
+		if scopeErr != nil {
+			fmt.Printf("Error: %s\n", scopeErr)
+			os.Exit(1)
+		}
+		report.SetScope(scope)
+	}
+
+	if *fix {
+		if fixErr := fixFiles(report, targetDirectory); fixErr != nil {
+			fmt.Printf("Error: %s\n", fixErr)
+			os.Exit(1)
+		}
+	}
 
 	files, err := findFiles(targetDirectory, "recipe.yaml")
 	if err != nil {
@@ -40,31 +82,51 @@ func main() {
 		os.Exit(1)
 	}
 
-	hasError := false
-
 	foundRecipes := make(map[string]terraModel.Recipe)
+	// invalidRecipes are the recipes which cannot be decoded, their children are reported
+	invalidRecipes := make(map[string]bool)
+	scripts := make([]*scriptKeys, 0)
 
 	for _, f := range files {
-		fmt.Printf("found %s\n", f)
+		report.Check(kindRecipe, f)
+		checkVersion(report, kindRecipe, f)
 		yamlRecipe, _ := ioutil.ReadFile(f)
 		t := terraGitModel.RecipeDefinition{}
 		t.Recipe.Path = f
-		err := yaml.Unmarshal(yamlRecipe, &t)
-		if err != nil {
-			fmt.Printf("Check:recipe:%s:error:, %s", t.Recipe.Path, err)
-			hasError = true
+		elts := strings.Split(f, "/")
+		name := elts[len(elts)-3]
+		version := elts[len(elts)-2]
+		if !decodeDefinition(report, kindRecipe, f, yamlRecipe, &t) {
+			// Keep invalid recipe, with the parent read if possible, to report its children and cycles
+			stub := terraGitModel.RecipeDefinition{}
+			yaml.Unmarshal(yamlRecipe, &stub)
+			if stub.Recipe.Resolve(targetDirectory) != nil {
+				stub.Recipe.Parent = ""
+			}
+			// Scripts do not depend on recipe definition, check them anyway
+			if keys := checkRecipeScript(report, f, stub.Recipe, filepath.Join(filepath.Dir(f), "recipe.sh")); keys != nil {
+				scripts = append(scripts, keys)
+			}
+			invalidRecipes[name+"/"+version] = true
+			foundRecipes[name+"/"+version] = terraModel.Recipe{
+				Remote:        name,
+				RemoteVersion: version,
+				ParentRecipe:  stub.Recipe.Parent,
+			}
+			continue
+		}
+		reportFindings(report, kindRecipe, f, yamlRecipe, t.Recipe.Check(targetDirectory))
+		checkDefaults(report, kindRecipe, f, t.Recipe.Defaults, t.Recipe.Inputs)
+		checkRequired(report, kindRecipe, f, t.Recipe.Defaults, t.Recipe.Inputs)
+		if keys := checkRecipeScript(report, f, t.Recipe, filepath.Join(filepath.Dir(f), "recipe.sh")); keys != nil {
+			scripts = append(scripts, keys)
 		}
-		errCheck := t.Recipe.Check()
-		if errCheck != nil {
-			fmt.Printf("Check:recipe:%s:ko: %s\n", t.Recipe.Name, errCheck)
-			hasError = true
+		if report.Count(f, severityError) > 0 {
+			report.Infof("Check:recipe:%s:ko\n", t.Recipe.Name)
+		} else {
+			report.Infof("Check:recipe:%s:ok\n", t.Recipe.Name)
 		}
-		fmt.Printf("Check:recipe:%s:ok\n", t.Recipe.Name)
 
-		t.Recipe.Path = f
-		elts := strings.Split(t.Recipe.Path, "/")
-		name := elts[len(elts)-3]
-		version := elts[len(elts)-2]
 		recipe := terraModel.Recipe{
 			Remote:        name,
 			RemoteVersion: version,
@@ -75,28 +137,41 @@ func main() {
 
 	}
 
+	// Parents are known once all recipes are read
+	recipeFiles := make(map[string]string)
+	for _, f := range files {
+		elts := strings.Split(f, "/")
+		recipeFiles[elts[len(elts)-3]+"/"+elts[len(elts)-2]] = f
+	}
+	checkRecipeInheritance(report, foundRecipes, invalidRecipes, recipeFiles)
+
 	files, err = findFiles(targetDirectory, "template.yaml")
 	if err != nil {
 		fmt.Printf("Error: %s", err)
 		os.Exit(1)
 	}
 
+	foundTemplates := make([]terraGitModel.Template, 0)
+	// decodedTemplates are all the templates read, even if their check fails
+	decodedTemplates := make([]terraGitModel.Template, 0)
+
 	for _, f := range files {
-		fmt.Printf("found %s\n", f)
+		report.Check(kindTemplate, f)
+		checkVersion(report, kindTemplate, f)
 		yamlTemplate, _ := ioutil.ReadFile(f)
 		t := terraGitModel.TemplateDefinition{}
 		t.Template.Path = f
-		err := yaml.Unmarshal(yamlTemplate, &t)
-		if err != nil {
-			fmt.Printf("Chec:template:%s:error: %s", t.Template.Path, err)
-			hasError = true
+		if !decodeDefinition(report, kindTemplate, f, yamlTemplate, &t) {
+			continue
 		}
-		errCheck := t.Template.Check()
-		if errCheck != nil {
-			fmt.Printf("Check:template:%s:error: %s\n", t.Template.Name, errCheck)
-			hasError = true
+		decodedTemplates = append(decodedTemplates, t.Template)
+		if reportFindings(report, kindTemplate, f, yamlTemplate, t.Template.Check()) {
+			continue
 		}
-		fmt.Printf("Check:template:%s:ok\n", t.Template.Name)
+		checkDefaults(report, kindTemplate, f, t.Template.Defaults, t.Template.Inputs)
+		checkRequired(report, kindTemplate, f, t.Template.Defaults, t.Template.Inputs)
+		report.Infof("Check:template:%s:ok\n", t.Template.Name)
+		foundTemplates = append(foundTemplates, t.Template)
 	}
 
 	files, err = findFiles(targetDirectory, "endpoint.yaml")
@@ -105,79 +180,228 @@ func main() {
 		os.Exit(1)
 	}
 
+	foundEndpoints := make([]terraGitModel.Endpoint, 0)
+
 	for _, f := range files {
-		fmt.Printf("found %s\n", f)
+		report.Check(kindEndpoint, f)
 		yamlTemplate, _ := ioutil.ReadFile(f)
 		t := terraGitModel.EndpointDefinition{}
 		t.Endpoint.Path = f
-		err := yaml.Unmarshal(yamlTemplate, &t)
-		if err != nil {
-			fmt.Printf("Chec:endpoint:%s:error: %s", t.Endpoint.Path, err)
-			hasError = true
+		if !decodeDefinition(report, kindEndpoint, f, yamlTemplate, &t) {
+			continue
+		}
+		if reportFindings(report, kindEndpoint, f, yamlTemplate, t.Endpoint.Check()) {
+			continue
+		}
+		checkRequired(report, kindEndpoint, f, t.Endpoint.Defaults, t.Endpoint.Inputs)
+		report.Infof("Check:endpoint:%s:ok\n", t.Endpoint.Name)
+		foundEndpoints = append(foundEndpoints, t.Endpoint)
+	}
+
+	// Template variables are provided by endpoints, check them once all are known
+	for _, t := range decodedTemplates {
+		checkTemplateVariables(report, t, foundEndpoints)
+	}
+
+	// Endpoint defaults are values of its inputs, or of the inputs of templates deployed on it
+	templateInputs := make(map[string]bool)
+	for _, t := range decodedTemplates {
+		for name := range t.Inputs {
+			templateInputs[name] = true
 		}
-		errCheck := t.Endpoint.Check()
-		if errCheck != nil {
-			fmt.Printf("Check:endpoint:%s:error: %s\n", t.Endpoint.Name, errCheck)
-			hasError = true
+	}
+	for _, e := range foundEndpoints {
+		checkDefaults(report, kindEndpoint, e.Path, e.Defaults, e.Inputs)
+		names := make([]string, 0, len(e.Defaults))
+		for name := range e.Defaults {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if _, ok := e.Inputs[name]; !ok && !templateInputs[name] {
+				report.Add(kindEndpoint, e.Path, 0, ruleInputDefault, severityWarning, fmt.Sprintf("default %s is not an input of endpoint nor of any template", name))
+			}
 		}
-		fmt.Printf("Check:endpoint:%s:ok\n", t.Endpoint.Name)
 	}
 
+	// goterra-cli keys are shared between recipes and templates of a deployment
+	for _, t := range foundTemplates {
+		scripts = append(scripts, templatePushKeys(t)...)
+	}
+	checkScriptKeys(report, scripts)
+
 	files, err = findFiles(targetDirectory, "app.yaml")
 	if err != nil {
 		fmt.Printf("Error: %s", err)
 		os.Exit(1)
 	}
 
+	appTemplates := make(map[string]bool)
 	for _, f := range files {
-		fmt.Printf("found %s\n", f)
+		report.Check(kindApplication, f)
+		checkVersion(report, kindApplication, f)
 		yamlApp, _ := ioutil.ReadFile(f)
 		t := terraGitModel.ApplicationDefinition{}
 		t.Application.Path = f
-		err := yaml.Unmarshal(yamlApp, &t)
-		if err != nil {
-			fmt.Printf("Chec:application:%s:error: %s", t.Application.Path, err)
-			hasError = true
-		}
-		expectedRecipes, errCheck := t.Application.Check()
-		if errCheck != nil {
-			fmt.Printf("Check:application:%s:error: %s\n", t.Application.Name, errCheck)
-			hasError = true
+		if !decodeDefinition(report, kindApplication, f, yamlApp, &t) {
+			continue
 		}
+		expectedRecipes, findings := t.Application.Check(targetDirectory)
+		reportFindings(report, kindApplication, f, yamlApp, findings)
 		appRecipes := make([]terraModel.Recipe, 0)
+		// Base images are only checked if all recipes are found and valid
+		recipesOk := true
 		for _, expectedRecipe := range expectedRecipes {
-			recipeFile := fmt.Sprintf("%s/recipes/%s/recipe.yaml", targetDirectory, expectedRecipe)
-			fmt.Printf("Check:application:%s:check:needs:%s\n", t.Application.Name, recipeFile)
+			recipeFile := terraGitModel.RecipeFile(targetDirectory, expectedRecipe)
+			report.Infof("Check:application:%s:check:needs:%s\n", t.Application.Name, recipeFile)
 			if _, ok := os.Stat(recipeFile); ok != nil {
-				fmt.Printf("Check:application:%s:needs:%s:error:notfound\n", t.Application.Name, recipeFile)
-				hasError = true
+				report.Add(kindApplication, f, 0, ruleRecipeNotFound, severityError, fmt.Sprintf("recipe %s not found", expectedRecipe))
+				recipesOk = false
+				continue
+			}
+			if invalidRecipes[expectedRecipe] {
+				report.Add(kindApplication, f, 0, ruleRecipeNotFound, severityError, fmt.Sprintf("recipe %s is invalid", expectedRecipe))
+				recipesOk = false
+				continue
 			}
 			appRecipes = append(appRecipes, foundRecipes[expectedRecipe])
 		}
 
-		bases, baseErr := t.Application.GetAppBaseImages(appRecipes, foundRecipes)
-		if baseErr != nil {
-			fmt.Printf("Check:application:%s:base_image:no base image found\n", t.Application.Name)
-			hasError = true
+		if recipesOk {
+			bases, baseErr := t.Application.GetAppBaseImages(appRecipes, foundRecipes)
+			if baseErr != nil {
+				report.Add(kindApplication, f, 0, ruleBaseImage, severityError, fmt.Sprintf("no base image found: %s", baseErr))
+			}
+			report.Infof("Check:application:%s:bases %+v\n", t.Application.Name, bases)
 		}
-		fmt.Printf("Check:application:%s:bases %+v\n", t.Application.Name, bases)
 
-		templateFile := fmt.Sprintf("%s/templates/%s/template.yaml", targetDirectory, t.Application.Template)
-		fmt.Printf("Check:application:%s:check:needs:%s\n", t.Application.Name, t.Application.Template)
-		if _, ok := os.Stat(templateFile); ok != nil {
-			fmt.Printf("Check:application:%s:needs:%s:error:notfound\n", t.Application.Name, templateFile)
-			hasError = true
+		appTemplates[t.Application.Template] = true
+		templateFile := terraGitModel.TemplateFile(targetDirectory, t.Application.Template)
+		report.Infof("Check:application:%s:check:needs:%s\n", t.Application.Name, t.Application.Template)
+		if _, ok := os.Stat(templateFile); ok != nil && t.Application.Template != "" {
+			report.Add(kindApplication, f, 0, ruleTemplateNotFound, severityError, fmt.Sprintf("template %s not found", t.Application.Template))
 		}
 
-		if hasError {
-			fmt.Printf("Check:application:%s:ko\n", t.Application.Name)
-
+		if report.Count(f, severityError) > 0 {
+			report.Infof("Check:application:%s:ko\n", t.Application.Name)
 		} else {
-			fmt.Printf("Check:application:%s:ok\n", t.Application.Name)
+			report.Infof("Check:application:%s:ok\n", t.Application.Name)
 		}
 	}
 
-	if hasError {
+	checkDeploymentDefaults(report, foundTemplates, foundEndpoints, appTemplates)
+
+	if writeErr := report.Write(); writeErr != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", writeErr)
+		os.Exit(1)
+	}
+	if *junitFile != "" {
+		if junitErr := report.WriteJUnit(*junitFile); junitErr != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", junitErr)
+			os.Exit(1)
+		}
+	}
+	if report.HasErrors() {
 		os.Exit(1)
 	}
 }
+
+// checkRecipeInheritance reports the recipes whose parents are missing, cyclic, too deep or invalid,
+// or which have no base image
+//
+// Invalid recipes are in recipes, with the parent read from their file if any, to report cycles
+// through them. Their own errors are already reported
+func checkRecipeInheritance(report *Report, recipes map[string]terraModel.Recipe, invalid map[string]bool, files map[string]string) {
+	parents := make(map[string]string)
+	keys := make([]string, 0, len(recipes))
+	for key, recipe := range recipes {
+		parents[key] = recipe.ParentRecipe
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	_, errs := terraGitModel.SortRecipes(parents)
+	for _, key := range keys {
+		if invalid[key] {
+			continue
+		}
+		if errs[key] != nil {
+			report.Add(kindRecipe, files[key], 0, ruleRecipeInheritance, severityError, errs[key].Error())
+			continue
+		}
+		// Ancestors are found and not cyclic once sorted
+		invalidParent := ""
+		for parent := parents[key]; parent != "" && invalidParent == ""; parent = parents[parent] {
+			if invalid[parent] {
+				invalidParent = parent
+			}
+		}
+		if invalidParent != "" {
+			report.Add(kindRecipe, files[key], 0, ruleRecipeInheritance, severityError, fmt.Sprintf("parent recipe %s is invalid", invalidParent))
+			continue
+		}
+		if _, baseErr := terraGitModel.GetRecipeBaseImages(recipes[key], recipes); baseErr != nil {
+			report.Add(kindRecipe, files[key], 0, ruleRecipeInheritance, severityError, baseErr.Error())
+		}
+	}
+}
+
+// checkDefaults reports the defaults of file not valid for their definition in inputs
+func checkDefaults(report *Report, kind string, file string, defaults map[string][]string, inputs terraGitModel.Inputs) {
+	for _, defaultErr := range inputs.CheckDefaults(defaults) {
+		report.Add(kind, file, 0, ruleInputDefault, severityError, defaultErr.Error())
+	}
+}
+
+// reportFindings reports the findings of the check of file, at the position of their field in file data,
+// and tells if one is an error
+func reportFindings(report *Report, kind string, file string, data []byte, findings terraGitModel.Findings) bool {
+	for _, finding := range findings {
+		line, column := terraGitModel.FieldPosition(data, finding.Field)
+		report.AddField(kind, file, line, column, finding.Field, finding.Rule, finding.Severity, finding.Message)
+	}
+	return findings.HasErrors()
+}
+
+// checkRequired reports, as notes, the required inputs of file without default value
+func checkRequired(report *Report, kind string, file string, defaults map[string][]string, inputs terraGitModel.Inputs) {
+	for _, name := range inputs.Unset(defaults) {
+		report.Add(kind, file, 0, ruleInputRequired, severityNote, fmt.Sprintf("input %s is required and has no default value", name))
+	}
+}
+
+// checkVersion reports the version directory of file of kind if it is not a valid version
+func checkVersion(report *Report, kind string, file string) {
+	version := filepath.Base(filepath.Dir(file))
+	if _, err := terraGitModel.ParseVersion(version); err != nil {
+		report.Add(kind, file, 0, ruleVersion, severityError, err.Error())
+	}
+}
+
+// checkDeploymentDefaults checks the endpoint defaults of template inputs, for each template used by
+// an application (in appTemplates) and endpoint it can be deployed on, an endpoint whose kind has
+// a file in template
+//
+// Endpoint inputs take precedence over template inputs of the same name
+func checkDeploymentDefaults(report *Report, templates []terraGitModel.Template, endpoints []terraGitModel.Endpoint, appTemplates map[string]bool) {
+	for _, t := range templates {
+		elts := strings.Split(t.Path, "/")
+		key := elts[len(elts)-3] + "/" + elts[len(elts)-2]
+		if !appTemplates[key] {
+			continue
+		}
+		for _, e := range endpoints {
+			if _, ok := t.Files[e.Kind]; !ok {
+				continue
+			}
+			defaults := make(map[string][]string)
+			for name, values := range e.Defaults {
+				if _, ok := e.Inputs[name]; !ok {
+					defaults[name] = values
+				}
+			}
+			for _, defaultErr := range t.Inputs.CheckDefaults(defaults) {
+				report.Add(kindEndpoint, e.Path, 0, ruleInputDefault, severityError, fmt.Sprintf("%s, for template %s", defaultErr, key))
+			}
+		}
+	}
+}
@@ -0,0 +1,339 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	terraGitModel "github.com/osallou/goterra-community/tools/model"
+	terraModel "github.com/osallou/goterra-lib/lib/model"
+)
+
+// Matrix output formats, in addition to text and json
+const formatMarkdown = "markdown"
+
+// Reasons an application cannot be deployed on an endpoint
+const (
+	reasonMissingImage    = "missing-image"
+	reasonMissingTemplate = "missing-cloud-template"
+	reasonMissingFeature  = "missing-feature"
+	reasonInvalid         = "invalid-application"
+)
+
+// Compatibility tells if an application can be deployed on an endpoint
+type Compatibility struct {
+	Application string   `json:"application"`
+	Endpoint    string   `json:"endpoint"`
+	Deployable  bool     `json:"deployable"`
+	Reasons     []string `json:"reasons"`
+	Messages    []string `json:"messages"`
+}
+
+// Matrix is the application x endpoint compatibility matrix of a catalog
+type Matrix struct {
+	Applications []string        `json:"applications"`
+	Endpoints    []string        `json:"endpoints"`
+	Pairs        []Compatibility `json:"pairs"`
+}
+
+// catalog is the content of a catalog directory, keyed by name/version (name for endpoints)
+//
+// References of recipes and apps are resolved, parentRefs and appRefs keep them as written
+type catalog struct {
+	recipes    map[string]terraModel.Recipe
+	templates  map[string]terraGitModel.Template
+	endpoints  map[string]terraGitModel.Endpoint
+	apps       map[string]terraGitModel.Application
+	parentRefs map[string]string
+	appRefs    map[string]appRefs
+}
+
+// appRefs are the template and recipes references of an application, as written
+type appRefs struct {
+	template string
+	recipes  []string
+}
+
+// loadCatalog reads the definitions of targetDir, ignoring files that cannot be read
+func loadCatalog(targetDir string) (*catalog, error) {
+	c := &catalog{
+		recipes:    make(map[string]terraModel.Recipe),
+		templates:  make(map[string]terraGitModel.Template),
+		endpoints:  make(map[string]terraGitModel.Endpoint),
+		apps:       make(map[string]terraGitModel.Application),
+		parentRefs: make(map[string]string),
+		appRefs:    make(map[string]appRefs),
+	}
+	itemKey := func(file string) string {
+		elts := strings.Split(file, "/")
+		return elts[len(elts)-3] + "/" + elts[len(elts)-2]
+	}
+
+	files, err := findFiles(targetDir, "recipe.yaml")
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		data, _ := ioutil.ReadFile(f)
+		t := terraGitModel.RecipeDefinition{}
+		if terraGitModel.Decode(f, data, &t) != nil {
+			continue
+		}
+		key := itemKey(f)
+		c.parentRefs[key] = t.Recipe.Parent
+		t.Recipe.Resolve(targetDir)
+		elts := strings.Split(key, "/")
+		c.recipes[key] = terraModel.Recipe{
+			Remote:        elts[0],
+			RemoteVersion: elts[1],
+			BaseImages:    t.Recipe.Base,
+			ParentRecipe:  t.Recipe.Parent,
+		}
+	}
+
+	files, err = findFiles(targetDir, "template.yaml")
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		data, _ := ioutil.ReadFile(f)
+		t := terraGitModel.TemplateDefinition{}
+		if terraGitModel.Decode(f, data, &t) != nil {
+			continue
+		}
+		t.Template.Path = f
+		c.templates[itemKey(f)] = t.Template
+	}
+
+	files, err = findFiles(targetDir, "endpoint.yaml")
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		data, _ := ioutil.ReadFile(f)
+		t := terraGitModel.EndpointDefinition{}
+		if terraGitModel.Decode(f, data, &t) != nil {
+			continue
+		}
+		t.Endpoint.Path = f
+		c.endpoints[path.Base(path.Dir(f))] = t.Endpoint
+	}
+
+	files, err = findFiles(targetDir, "app.yaml")
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		data, _ := ioutil.ReadFile(f)
+		t := terraGitModel.ApplicationDefinition{}
+		if terraGitModel.Decode(f, data, &t) != nil {
+			continue
+		}
+		t.Application.Path = f
+		refs := appRefs{template: t.Application.Template}
+		slots := make([]string, 0, len(t.Application.Recipes))
+		for slot := range t.Application.Recipes {
+			slots = append(slots, slot)
+		}
+		sort.Strings(slots)
+		for _, slot := range slots {
+			refs.recipes = append(refs.recipes, t.Application.Recipes[slot]...)
+		}
+		c.appRefs[itemKey(f)] = refs
+		t.Application.Resolve(targetDir)
+		c.apps[itemKey(f)] = t.Application
+	}
+	return c, nil
+}
+
+// compatibility checks if app can be deployed on endpoint
+//
+// Endpoint must provide one of the base images of app recipes, template must have a file
+// for endpoint kind, and endpoint must define the features used by this file
+func (c *catalog) compatibility(appKey string, endpointName string) Compatibility {
+	app := c.apps[appKey]
+	endpoint := c.endpoints[endpointName]
+	result := Compatibility{Application: appKey, Endpoint: endpointName, Reasons: make([]string, 0), Messages: make([]string, 0)}
+	block := func(reason string, message string) {
+		result.Reasons = append(result.Reasons, reason)
+		result.Messages = append(result.Messages, message)
+	}
+
+	expectedRecipes := make([]string, 0)
+	for _, recipes := range app.Recipes {
+		expectedRecipes = append(expectedRecipes, recipes...)
+	}
+	if len(expectedRecipes) > 0 {
+		appRecipes := make([]terraModel.Recipe, 0)
+		for _, expectedRecipe := range expectedRecipes {
+			appRecipes = append(appRecipes, c.recipes[expectedRecipe])
+		}
+		bases, err := app.GetAppBaseImages(appRecipes, c.recipes)
+		if err != nil {
+			block(reasonInvalid, fmt.Sprintf("no base image found: %s", err))
+		} else {
+			found := false
+			for _, base := range bases {
+				if _, ok := endpoint.Images[base]; ok {
+					found = true
+					break
+				}
+			}
+			if !found {
+				block(reasonMissingImage, fmt.Sprintf("endpoint has none of images %v", bases))
+			}
+		}
+	}
+
+	template, ok := c.templates[app.Template]
+	if !ok {
+		block(reasonInvalid, fmt.Sprintf("template %s not found", app.Template))
+		return result.done()
+	}
+	tfFile, ok := template.Files[endpoint.Kind]
+	if !ok {
+		block(reasonMissingTemplate, fmt.Sprintf("template %s has no file for %s", app.Template, endpoint.Kind))
+		return result.done()
+	}
+	_, used, err := terraformVariables(fmt.Sprintf("%s/%s/%s", path.Dir(template.Path), endpoint.Kind, tfFile))
+	if err != nil {
+		block(reasonMissingTemplate, fmt.Sprintf("cannot read template file: %s", err))
+		return result.done()
+	}
+	features := make([]string, 0)
+	for name := range used {
+		if strings.HasPrefix(name, terraGitModel.FeaturePrefix) {
+			features = append(features, strings.TrimPrefix(name, terraGitModel.FeaturePrefix))
+		}
+	}
+	sort.Strings(features)
+	for _, feature := range features {
+		if _, ok := endpoint.Features[feature]; !ok {
+			block(reasonMissingFeature, fmt.Sprintf("endpoint does not define feature %s", feature))
+		}
+	}
+	return result.done()
+}
+
+// done sets deployable status from blocking reasons
+func (result Compatibility) done() Compatibility {
+	result.Deployable = len(result.Reasons) == 0
+	return result
+}
+
+// matrix computes compatibility of each application with each endpoint
+func (c *catalog) matrix() Matrix {
+	m := Matrix{Applications: make([]string, 0, len(c.apps)), Endpoints: make([]string, 0, len(c.endpoints)), Pairs: make([]Compatibility, 0)}
+	for app := range c.apps {
+		m.Applications = append(m.Applications, app)
+	}
+	sort.Strings(m.Applications)
+	for endpoint := range c.endpoints {
+		m.Endpoints = append(m.Endpoints, endpoint)
+	}
+	sort.Strings(m.Endpoints)
+	for _, app := range m.Applications {
+		for _, endpoint := range m.Endpoints {
+			m.Pairs = append(m.Pairs, c.compatibility(app, endpoint))
+		}
+	}
+	return m
+}
+
+// cell returns the short status of a pair
+func (result Compatibility) cell() string {
+	if result.Deployable {
+		return "ok"
+	}
+	return strings.Join(result.Reasons, ",")
+}
+
+// Write outputs matrix to w in format (text, json or markdown)
+func (m Matrix) Write(w io.Writer, format string) error {
+	switch format {
+	case formatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.SetEscapeHTML(false)
+		return enc.Encode(m)
+	case formatMarkdown:
+		fmt.Fprintf(w, "| application | %s |\n", strings.Join(m.Endpoints, " | "))
+		fmt.Fprintf(w, "|---|%s\n", strings.Repeat("---|", len(m.Endpoints)))
+		for i, app := range m.Applications {
+			cells := make([]string, 0, len(m.Endpoints))
+			for _, pair := range m.Pairs[i*len(m.Endpoints) : (i+1)*len(m.Endpoints)] {
+				if pair.Deployable {
+					cells = append(cells, "✅")
+				} else {
+					cells = append(cells, "❌ "+strings.Join(pair.Messages, "<br>"))
+				}
+			}
+			fmt.Fprintf(w, "| %s | %s |\n", app, strings.Join(cells, " | "))
+		}
+		return nil
+	case formatText:
+		width := len("application")
+		for _, app := range m.Applications {
+			if len(app) > width {
+				width = len(app)
+			}
+		}
+		fmt.Fprintf(w, "%-*s", width, "application")
+		for _, endpoint := range m.Endpoints {
+			fmt.Fprintf(w, "  %s", endpoint)
+		}
+		fmt.Fprintln(w)
+		for i, app := range m.Applications {
+			line := fmt.Sprintf("%-*s", width, app)
+			for j, endpoint := range m.Endpoints {
+				line += fmt.Sprintf("  %-*s", len(endpoint), m.Pairs[i*len(m.Endpoints)+j].cell())
+			}
+			fmt.Fprintln(w, strings.TrimRight(line, " "))
+		}
+		fmt.Fprintln(w)
+		for _, pair := range m.Pairs {
+			for _, message := range pair.Messages {
+				fmt.Fprintf(w, "%s on %s: %s\n", pair.Application, pair.Endpoint, message)
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown format %s, expecting text, json or markdown", format)
+}
+
+// matrixCommand prints the application x endpoint compatibility matrix of a catalog
+func matrixCommand(args []string) int {
+	flags := flag.NewFlagSet("matrix", flag.ExitOnError)
+	format := flags.String("format", formatText, "output format: text, json or markdown")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "USAGE : %s matrix [options] <target_directory>\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() < 1 {
+		flags.Usage()
+		return 1
+	}
+	switch *format {
+	case formatText, formatJSON, formatMarkdown:
+	default:
+		fmt.Printf("Error: unknown format %s, expecting text, json or markdown\n", *format)
+		return 1
+	}
+	c, err := loadCatalog(flags.Arg(0))
+	if err != nil {
+		fmt.Printf("Error: %s\n", err)
+		return 1
+	}
+	if err := c.matrix().Write(os.Stdout, *format); err != nil {
+		fmt.Printf("Error: %s\n", err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,367 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	terraGitModel "github.com/osallou/goterra-community/tools/model"
+)
+
+// Output formats
+const (
+	formatText  = "text"
+	formatJSON  = "json"
+	formatSarif = "sarif"
+)
+
+// Finding severities, same as SARIF levels
+const (
+	severityError   = "error"
+	severityWarning = "warning"
+	severityNote    = "note"
+)
+
+// Finding kinds
+const (
+	kindRecipe      = "recipe"
+	kindTemplate    = "template"
+	kindEndpoint    = "endpoint"
+	kindApplication = "application"
+)
+
+// Rule ids, check rules are defined by model
+const (
+	ruleYAML               = "yaml"
+	ruleRecipeNotFound     = "recipe-not-found"
+	ruleTemplateNotFound   = "template-not-found"
+	ruleBaseImage          = "base-image"
+	ruleInputUnused        = "input-unused"
+	ruleVariableUndeclared = "variable-undeclared"
+	ruleRecipeInheritance  = "recipe-inheritance"
+	ruleRecipeScript       = "recipe-script"
+	ruleScriptSyntax       = "script-syntax"
+	ruleScriptKey          = "script-key"
+	ruleInputDefault       = "input-default"
+	ruleSchema             = "schema"
+	ruleVersion            = "version"
+	ruleInputRequired      = "input-required"
+	ruleTerraform          = "terraform"
+)
+
+// rules describes the rules reported by linter
+var rules = map[string]string{
+	ruleYAML:                         "File is not valid YAML or does not match expected structure",
+	terraGitModel.RuleMissingField:   "Mandatory field of definition is missing or empty",
+	terraGitModel.RuleInput:          "Input definition is not valid",
+	terraGitModel.RuleParentNotFound: "Recipe parent is not found in catalog",
+	terraGitModel.RuleFileNotFound:   "Template file is not found",
+	terraGitModel.RuleRecipeSlot:     "Application recipes do not match the recipes variables of template",
+	terraGitModel.RuleReference:      "Version constraint of reference is invalid or matches no version in catalog",
+	ruleRecipeNotFound:               "Application uses a recipe not found in catalog, or invalid",
+	ruleTemplateNotFound:             "Application uses a template not found in catalog",
+	ruleBaseImage:                    "No base image is common to the recipes of application",
+	ruleInputUnused:                  "Input or recipes variable is not used in terraform file or recipe script",
+	ruleVariableUndeclared:           "Terraform variable is used but not declared by template, endpoints or variable blocks",
+	ruleRecipeInheritance:            "Recipe parents are missing, cyclic, too deep or have no base image",
+	ruleRecipeScript:                 "Recipe script recipe.sh is missing or has no shebang",
+	ruleScriptSyntax:                 "Recipe script is not valid bash",
+	ruleScriptKey:                    "Recipe script reads a goterra-cli key no recipe puts",
+	ruleInputDefault:                 "Default value is not valid for its input definition",
+	ruleSchema:                       "Definition does not match its JSON Schema",
+	ruleVersion:                      "Directory name of catalog item is not a valid version",
+	ruleInputRequired:                "Required input has no default value, deployments must set it",
+	ruleTerraform:                    "Terraform file of template is not valid HCL",
+}
+
+// Finding is a problem found on a file
+//
+// Field is the path of the field in definition file, like recipe.inputs.size, if known
+type Finding struct {
+	Kind     string `json:"kind"`
+	File     string `json:"file"`
+	Line     int    `json:"line,omitempty"`
+	Column   int    `json:"column,omitempty"`
+	Field    string `json:"field,omitempty"`
+	Rule     string `json:"rule"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
+
+// CheckedFile is a file checked by linter
+type CheckedFile struct {
+	Kind string
+	File string
+}
+
+// Report collects checked files and findings, and prints progress in text format
+type Report struct {
+	Format   string
+	Files    []CheckedFile
+	Findings []Finding
+	out      io.Writer
+	// scope tells if a file must be reported, all files are if nil
+	scope func(file string) bool
+	// quiet hides progress of current file, out of scope
+	quiet bool
+}
+
+// NewReport creates a report written to out in format
+func NewReport(format string, out io.Writer) (*Report, error) {
+	switch format {
+	case formatText, formatJSON, formatSarif:
+	default:
+		return nil, fmt.Errorf("unknown format %s, expecting text, json or sarif", format)
+	}
+	return &Report{Format: format, Files: make([]CheckedFile, 0), Findings: make([]Finding, 0), out: out}, nil
+}
+
+// yamlLine matches line number in yaml errors
+var yamlLine = regexp.MustCompile(`line (\d+)`)
+
+// errorLine returns line number of a yaml error, 0 if unknown
+func errorLine(err error) int {
+	match := yamlLine.FindStringSubmatch(err.Error())
+	if match == nil {
+		return 0
+	}
+	line, _ := strconv.Atoi(match[1])
+	return line
+}
+
+// Check records file of kind as checked
+func (r *Report) Check(kind string, file string) {
+	r.quiet = r.scope != nil && !r.scope(file)
+	if r.quiet {
+		return
+	}
+	r.Files = append(r.Files, CheckedFile{Kind: kind, File: filepath.ToSlash(filepath.Clean(file))})
+	r.Infof("found %s\n", file)
+}
+
+// Add records a finding on file
+func (r *Report) Add(kind string, file string, line int, rule string, severity string, message string) {
+	r.AddAt(kind, file, line, 0, rule, severity, message)
+}
+
+// AddAt records a finding on file at line and column
+func (r *Report) AddAt(kind string, file string, line int, column int, rule string, severity string, message string) {
+	r.AddField(kind, file, line, column, "", rule, severity, message)
+}
+
+// AddField records a finding on field of definition file, at line and column
+func (r *Report) AddField(kind string, file string, line int, column int, field string, rule string, severity string, message string) {
+	if r.scope != nil && !r.scope(file) {
+		return
+	}
+	f := Finding{
+		Kind:     kind,
+		File:     filepath.ToSlash(filepath.Clean(file)),
+		Line:     line,
+		Column:   column,
+		Field:    field,
+		Rule:     rule,
+		Severity: severity,
+		Message:  message,
+	}
+	r.Findings = append(r.Findings, f)
+	if r.Format == formatText {
+		fmt.Fprintf(r.out, "Check:%s:%s:%s:%s: %s\n", f.Kind, f.position(), f.Severity, f.Rule, f.text())
+	}
+}
+
+// text returns message of finding, prefixed by its field if known
+func (f Finding) text() string {
+	if f.Field == "" {
+		return f.Message
+	}
+	return f.Field + ": " + f.Message
+}
+
+// position returns file of finding, with line and column if known
+func (f Finding) position() string {
+	switch {
+	case f.Line > 0 && f.Column > 0:
+		return fmt.Sprintf("%s:%d:%d", f.File, f.Line, f.Column)
+	case f.Line > 0:
+		return fmt.Sprintf("%s:%d", f.File, f.Line)
+	}
+	return f.File
+}
+
+// owner returns the checked file owning file: file itself if checked, else the checked
+// definition file of the item directory containing file (template.yaml of a .tf file)
+func (r *Report) owner(file string) string {
+	file = filepath.ToSlash(filepath.Clean(file))
+	owner := file
+	ownerDir := ""
+	for _, checked := range r.Files {
+		if checked.File == file {
+			return file
+		}
+		dir := path.Dir(checked.File)
+		if strings.HasPrefix(file, dir+"/") && len(dir) > len(ownerDir) {
+			owner = checked.File
+			ownerDir = dir
+		}
+	}
+	return owner
+}
+
+// SetScope limits report to the files accepted by scope
+func (r *Report) SetScope(scope func(file string) bool) {
+	r.scope = scope
+}
+
+// Infof prints progress information of current file, in text format only
+func (r *Report) Infof(format string, args ...interface{}) {
+	if r.Format == formatText && !r.quiet {
+		fmt.Fprintf(r.out, format, args...)
+	}
+}
+
+// Count returns the number of findings of file with severity, including the findings of the files it owns
+func (r *Report) Count(file string, severity string) int {
+	file = filepath.ToSlash(filepath.Clean(file))
+	count := 0
+	for _, f := range r.Findings {
+		if r.owner(f.File) == file && f.Severity == severity {
+			count++
+		}
+	}
+	return count
+}
+
+// HasErrors tells if an error was found
+func (r *Report) HasErrors() bool {
+	for _, f := range r.Findings {
+		if f.Severity == severityError {
+			return true
+		}
+	}
+	return false
+}
+
+// Write outputs findings in json or sarif format, nothing to do in text format
+func (r *Report) Write() error {
+	switch r.Format {
+	case formatJSON:
+		enc := json.NewEncoder(r.out)
+		enc.SetIndent("", "  ")
+		enc.SetEscapeHTML(false)
+		return enc.Encode(map[string]interface{}{"findings": r.Findings})
+	case formatSarif:
+		enc := json.NewEncoder(r.out)
+		enc.SetIndent("", "  ")
+		enc.SetEscapeHTML(false)
+		return enc.Encode(r.sarif())
+	}
+	return nil
+}
+
+// SARIF 2.1.0 subset
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation  `json:"physicalLocation"`
+	LogicalLocations []sarifLogicalLocation `json:"logicalLocations,omitempty"`
+}
+
+type sarifLogicalLocation struct {
+	FullyQualifiedName string `json:"fullyQualifiedName"`
+	Kind               string `json:"kind"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           *sarifRegion          `json:"region,omitempty"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn,omitempty"`
+}
+
+// sarif converts findings to a SARIF log
+func (r *Report) sarif() sarifLog {
+	ids := make([]string, 0, len(rules))
+	for id := range rules {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	driver := sarifDriver{
+		Name:           "goterra-linter",
+		InformationURI: "https://github.com/osallou/goterra-community",
+		Rules:          make([]sarifRule, 0, len(ids)),
+	}
+	for _, id := range ids {
+		driver.Rules = append(driver.Rules, sarifRule{ID: id, ShortDescription: sarifMessage{Text: rules[id]}})
+	}
+
+	results := make([]sarifResult, 0, len(r.Findings))
+	for _, f := range r.Findings {
+		location := sarifLocation{PhysicalLocation: sarifPhysicalLocation{ArtifactLocation: sarifArtifactLocation{URI: f.File}}}
+		if f.Line > 0 {
+			location.PhysicalLocation.Region = &sarifRegion{StartLine: f.Line, StartColumn: f.Column}
+		}
+		if f.Field != "" {
+			location.LogicalLocations = []sarifLogicalLocation{{FullyQualifiedName: f.Field, Kind: "member"}}
+		}
+		results = append(results, sarifResult{
+			RuleID:    f.Rule,
+			Level:     f.Severity,
+			Message:   sarifMessage{Text: fmt.Sprintf("%s: %s", f.Kind, f.text())},
+			Locations: []sarifLocation{location},
+		})
+	}
+	return sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs:    []sarifRun{{Tool: sarifTool{Driver: driver}, Results: results}},
+	}
+}
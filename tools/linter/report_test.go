@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update golden files of tests")
+
+// golden compares got to golden file, or writes it with -update
+func golden(t *testing.T, file string, got string) {
+	if *update {
+		if err := ioutil.WriteFile(file, []byte(got), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != string(want) {
+		t.Errorf("%s differs:\n%s", file, unifiedDiff(file, string(want), got))
+	}
+}
+
+// testReport returns a report with findings of each severity, on definitions and the files they own
+func testReport(t *testing.T, format string) *Report {
+	report, err := NewReport(format, ioutil.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report.Check(kindRecipe, "recipes/a/v1.0/recipe.yaml")
+	report.Check(kindRecipe, "recipes/b/v1.0/recipe.yaml")
+	report.Check(kindTemplate, "templates/vm/v1.0/template.yaml")
+	report.Check(kindApplication, "apps/web/v1.0/app.yaml")
+	report.AddField(kindRecipe, "recipes/a/v1.0/recipe.yaml", 3, 9, "recipe.inputs.size", ruleInputDefault, severityError, "default <x> is not an integer")
+	report.Add(kindRecipe, "recipes/a/v1.0/recipe.sh", 0, ruleRecipeScript, severityError, "recipe.sh has no shebang")
+	report.Add(kindRecipe, "recipes/a/v1.0/recipe.sh", 12, ruleScriptSyntax, severityWarning, "unexpected end of file")
+	report.AddAt(kindTemplate, "templates/vm/v1.0/openstack/app.tf", 4, 15, ruleVariableUndeclared, severityError, "variable var.ip is not declared")
+	report.AddField(kindTemplate, "templates/vm/v1.0/template.yaml", 7, 5, "template.inputs.size", ruleInputUnused, severityNote, "input size is not used")
+	report.Add(kindApplication, "apps/web/v1.0/app.yaml", 0, ruleRecipeNotFound, severityWarning, "recipe c/v1.0 is invalid")
+	return report
+}
+
+func TestJUnit(t *testing.T) {
+	junit := testReport(t, formatJSON).junit()
+	if junit.Tests != 4 || junit.Failures != 2 {
+		t.Errorf("testsuites counts tests=%d failures=%d, want 4 and 2", junit.Tests, junit.Failures)
+	}
+	want := map[string][2]int{"recipes": {2, 1}, "templates": {1, 1}, "endpoints": {0, 0}, "applications": {1, 0}}
+	for _, suite := range junit.Suites {
+		if counts := [2]int{suite.Tests, suite.Failures}; counts != want[suite.Name] {
+			t.Errorf("suite %s counts tests, failures = %v, want %v", suite.Name, counts, want[suite.Name])
+		}
+	}
+	if failures := len(junit.Suites[0].Cases[0].Failures); failures != 2 {
+		t.Errorf("recipe a has %d failures, want 2 including its script", failures)
+	}
+
+	dir, err := ioutil.TempDir("", "goterra-linter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "junit.xml")
+	if err := testReport(t, formatJSON).WriteJUnit(file); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	got, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	golden(t, "testdata/report/junit.xml", string(got))
+}
+
+func TestSarif(t *testing.T) {
+	out := &bytes.Buffer{}
+	report := testReport(t, formatSarif)
+	report.out = out
+	if err := report.Write(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	golden(t, "testdata/report/sarif.json", out.String())
+
+	var log sarifLog
+	if err := json.Unmarshal(out.Bytes(), &log); err != nil {
+		t.Fatalf("invalid sarif json: %s", err)
+	}
+	if log.Version != "2.1.0" || len(log.Runs) != 1 {
+		t.Fatalf("sarif version %s with %d runs, want 2.1.0 with 1 run", log.Version, len(log.Runs))
+	}
+	run := log.Runs[0]
+	ruleIDs := make(map[string]bool)
+	for _, rule := range run.Tool.Driver.Rules {
+		if rule.ShortDescription.Text == "" {
+			t.Errorf("rule %s has no description", rule.ID)
+		}
+		ruleIDs[rule.ID] = true
+	}
+	if len(run.Results) != len(report.Findings) {
+		t.Fatalf("got %d results, want %d", len(run.Results), len(report.Findings))
+	}
+	for i, result := range run.Results {
+		f := report.Findings[i]
+		if !ruleIDs[result.RuleID] {
+			t.Errorf("result %d rule %s is not described", i, result.RuleID)
+		}
+		if result.Level != f.Severity {
+			t.Errorf("result %d level %s, want %s", i, result.Level, f.Severity)
+		}
+		region := result.Locations[0].PhysicalLocation.Region
+		switch {
+		case f.Line == 0 && region != nil:
+			t.Errorf("result %d has a region without line", i)
+		case f.Line > 0 && (region == nil || region.StartLine != f.Line || region.StartColumn != f.Column):
+			t.Errorf("result %d region %+v, want line %d column %d", i, region, f.Line, f.Column)
+		}
+	}
+}
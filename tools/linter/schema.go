@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	terraGitModel "github.com/osallou/goterra-community/tools/model"
+)
+
+// schemaFiles are the names of generated schema files, per definition root key
+var schemaFiles = map[string]string{
+	"recipe":      "recipe.schema.json",
+	"template":    "template.schema.json",
+	"endpoint":    "endpoint.schema.json",
+	"application": "app.schema.json",
+}
+
+// decodeDefinition strictly reads definition file of kind in def, and reports its errors
+func decodeDefinition(report *Report, kind string, file string, data []byte, def interface{}) bool {
+	err := terraGitModel.Decode(file, data, def)
+	switch decodeErr := err.(type) {
+	case nil:
+		return true
+	case terraGitModel.DecodeErrors:
+		for _, e := range decodeErr {
+			report.AddField(kind, file, e.Line, e.Column, e.Path, ruleSchema, severityError, e.Message)
+		}
+	case *terraGitModel.DecodeError:
+		report.AddAt(kind, file, decodeErr.Line, decodeErr.Column, ruleYAML, severityError, decodeErr.Message)
+	default:
+		report.Add(kind, file, errorLine(err), ruleYAML, severityError, err.Error())
+	}
+	return false
+}
+
+// schemaCommand writes the JSON Schemas of definition files
+func schemaCommand(args []string) int {
+	flags := flag.NewFlagSet("schema", flag.ExitOnError)
+	outDir := flags.String("out", ".", "directory to write schemas to")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "USAGE : %s schema [options]\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if err := os.MkdirAll(*outDir, 0755); err != nil {
+		fmt.Printf("Error: %s\n", err)
+		return 1
+	}
+	for _, kind := range terraGitModel.DefinitionKinds() {
+		s, err := terraGitModel.DefinitionSchema(kind)
+		if err != nil {
+			fmt.Printf("Error: %s\n", err)
+			return 1
+		}
+		data, err := json.MarshalIndent(s, "", "  ")
+		if err != nil {
+			fmt.Printf("Error: %s\n", err)
+			return 1
+		}
+		file := filepath.Join(*outDir, schemaFiles[kind])
+		if err := ioutil.WriteFile(file, append(data, '\n'), 0644); err != nil {
+			fmt.Printf("Error: failed to write %s: %s\n", file, err)
+			return 1
+		}
+		fmt.Printf("Schema:%s:%s\n", kind, file)
+	}
+	return 0
+}
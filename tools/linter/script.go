@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strings"
+
+	terraGitModel "github.com/osallou/goterra-community/tools/model"
+)
+
+// scriptKeys are the goterra-cli keys read (get) and written (put) by a recipe script
+type scriptKeys struct {
+	file string
+	// gets maps read keys to the line of their first read
+	gets map[string]int
+	puts []string
+}
+
+// goterraCli matches goterra-cli get/put commands, and the key they use
+var goterraCli = regexp.MustCompile(`goterra-cli\s.*?\b(get|put)\s+("[^"]*"|'[^']*'|\S+)`)
+
+// checkRecipeScript checks recipe.sh of a recipe: file must exist, start with a shebang and
+// be valid bash. Recipe inputs not used in script are reported.
+//
+// It returns the goterra-cli keys of script, nil if script cannot be read
+func checkRecipeScript(report *Report, recipeFile string, recipe terraGitModel.Recipe, scriptFile string) *scriptKeys {
+	script, err := ioutil.ReadFile(scriptFile)
+	if err != nil {
+		report.Add(kindRecipe, recipeFile, 0, ruleRecipeScript, severityError, fmt.Sprintf("recipe script %s not found", scriptFile))
+		return nil
+	}
+	if !bytes.HasPrefix(script, []byte("#!")) {
+		report.Add(kindRecipe, scriptFile, 1, ruleRecipeScript, severityError, "recipe script does not start with a shebang (#!/bin/bash)")
+	}
+
+	if bash, lookErr := exec.LookPath("bash"); lookErr != nil {
+		report.Infof("Check:recipe:%s:bash not found, skipping syntax check\n", recipe.Name)
+	} else if out, syntaxErr := exec.Command(bash, "-n", scriptFile).CombinedOutput(); syntaxErr != nil {
+		for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+			report.Add(kindRecipe, scriptFile, bashErrorLine(line), ruleScriptSyntax, severityError, line)
+		}
+	}
+
+	inputs := make([]string, 0, len(recipe.Inputs))
+	for input := range recipe.Inputs {
+		inputs = append(inputs, input)
+	}
+	sort.Strings(inputs)
+	for _, input := range inputs {
+		ref := regexp.MustCompile(`\$\{?(` + regexp.QuoteMeta(input) + `|` + regexp.QuoteMeta(strings.ToUpper(input)) + `)\b`)
+		if !ref.Match(script) {
+			report.Add(kindRecipe, recipeFile, 0, ruleInputUnused, severityWarning, fmt.Sprintf("input %s is not used in %s", input, scriptFile))
+		}
+	}
+
+	keys := &scriptKeys{file: scriptFile, gets: make(map[string]int), puts: make([]string, 0)}
+	scanner := bufio.NewScanner(bytes.NewReader(script))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(text, "#") {
+			continue
+		}
+		for _, match := range goterraCli.FindAllStringSubmatch(text, -1) {
+			key := strings.Trim(match[2], "\"'`")
+			if match[1] == "put" {
+				keys.puts = append(keys.puts, key)
+			} else if _, ok := keys.gets[key]; !ok {
+				keys.gets[key] = line
+			}
+		}
+	}
+	return keys
+}
+
+// bashLine matches line number in bash -n errors (file: line 3: ...)
+var bashLine = regexp.MustCompile(`line (\d+):`)
+
+// bashErrorLine returns line number of a bash error, 0 if unknown
+func bashErrorLine(msg string) int {
+	match := bashLine.FindStringSubmatch(msg)
+	if match == nil {
+		return 0
+	}
+	line := 0
+	fmt.Sscanf(match[1], "%d", &line)
+	return line
+}
+
+// keyPattern returns the fixed prefix of a key, and if key is built from variables (slurm_ip_${my})
+func keyPattern(key string) (string, bool) {
+	if i := strings.Index(key, "$"); i >= 0 {
+		return key[:i], true
+	}
+	return key, false
+}
+
+// checkScriptKeys reports the goterra-cli keys read by a script but written by no recipe of catalog
+//
+// Keys built from variables match the keys with the same fixed prefix
+func checkScriptKeys(report *Report, scripts []*scriptKeys) {
+	puts := make(map[string]bool)
+	putPrefixes := make([]string, 0)
+	for _, script := range scripts {
+		for _, key := range script.puts {
+			prefix, dynamic := keyPattern(key)
+			if dynamic {
+				putPrefixes = append(putPrefixes, prefix)
+			} else {
+				puts[key] = true
+			}
+		}
+	}
+	written := func(key string) bool {
+		prefix, dynamic := keyPattern(key)
+		if !dynamic && puts[key] {
+			return true
+		}
+		for _, putPrefix := range putPrefixes {
+			if strings.HasPrefix(prefix, putPrefix) || strings.HasPrefix(putPrefix, prefix) {
+				return true
+			}
+		}
+		if dynamic {
+			for put := range puts {
+				if strings.HasPrefix(put, prefix) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+
+	for _, script := range scripts {
+		keys := make([]string, 0, len(script.gets))
+		for key := range script.gets {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if !written(key) {
+				report.Add(kindRecipe, script.file, script.gets[key], ruleScriptKey, severityError, fmt.Sprintf("goterra-cli key %s is read but never put by a recipe", key))
+			}
+		}
+	}
+}
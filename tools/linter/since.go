@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+
+	terraGitModel "github.com/osallou/goterra-community/tools/model"
+)
+
+// itemSet lists catalog items per kind, keyed by name/version (name for endpoints)
+type itemSet map[string]map[string]bool
+
+// add records item of kind
+func (s itemSet) add(kind string, key string) {
+	if s[kind] == nil {
+		s[kind] = make(map[string]bool)
+	}
+	s[kind][key] = true
+}
+
+// has tells if item of kind is in set
+func (s itemSet) has(kind string, key string) bool {
+	return s[kind][key]
+}
+
+// catalogItem returns the kind and key of the item a catalog file (relative to catalog root) belongs to
+func catalogItem(file string) (string, string, bool) {
+	elts := strings.Split(filepath.ToSlash(file), "/")
+	if len(elts) < 3 {
+		return "", "", false
+	}
+	switch elts[0] {
+	case "endpoints":
+		return kindEndpoint, elts[1], true
+	case "recipes", "templates", "apps":
+		if len(elts) < 4 {
+			return "", "", false
+		}
+		kind := map[string]string{"recipes": kindRecipe, "templates": kindTemplate, "apps": kindApplication}[elts[0]]
+		return kind, elts[1] + "/" + elts[2], true
+	}
+	return "", "", false
+}
+
+// changedItems returns the items of catalog targetDir changed since git ref,
+// in commits up to HEAD or in working tree
+func changedItems(targetDir string, ref string) (itemSet, error) {
+	repo, err := git.PlainOpenWithOptions(targetDir, &git.PlainOpenOptions{DetectDotGit: true})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open git repository: %s", err)
+	}
+	workTree, err := repo.Worktree()
+	if err != nil {
+		return nil, err
+	}
+	absTarget, err := filepath.Abs(targetDir)
+	if err != nil {
+		return nil, err
+	}
+	catalogDir, err := filepath.Rel(workTree.Filesystem.Root(), absTarget)
+	if err != nil {
+		return nil, err
+	}
+
+	sinceHash, err := repo.ResolveRevision(plumbing.Revision(ref))
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %s: %s", ref, err)
+	}
+	head, err := repo.Head()
+	if err != nil {
+		return nil, err
+	}
+	trees := make([]*object.Tree, 0, 2)
+	for _, hash := range []plumbing.Hash{*sinceHash, head.Hash()} {
+		commit, commitErr := repo.CommitObject(hash)
+		if commitErr != nil {
+			return nil, commitErr
+		}
+		tree, treeErr := commit.Tree()
+		if treeErr != nil {
+			return nil, treeErr
+		}
+		trees = append(trees, tree)
+	}
+	changes, err := trees[0].Diff(trees[1])
+	if err != nil {
+		return nil, err
+	}
+	paths := make([]string, 0, len(changes))
+	for _, change := range changes {
+		paths = append(paths, change.From.Name, change.To.Name)
+	}
+	status, err := workTree.Status()
+	if err != nil {
+		return nil, err
+	}
+	for path, fileStatus := range status {
+		if fileStatus.Worktree != git.Unmodified || fileStatus.Staging != git.Unmodified {
+			paths = append(paths, path)
+		}
+	}
+
+	items := make(itemSet)
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+		rel, relErr := filepath.Rel(catalogDir, filepath.FromSlash(path))
+		if relErr != nil || strings.HasPrefix(rel, "..") {
+			continue
+		}
+		if kind, key, ok := catalogItem(rel); ok {
+			items.add(kind, key)
+		}
+	}
+	return items, nil
+}
+
+// addDependents adds to items the recipes inheriting from a changed recipe,
+// and the applications using a changed template or recipe (or a recipe inheriting from it)
+//
+// References are matched as written: a name@constraint reference depends on every version of name,
+// as adding or removing one may change the version it resolves to
+func (s itemSet) addDependents(c *catalog) {
+	for added := true; added; {
+		added = false
+		for key := range c.recipes {
+			if !s.has(kindRecipe, key) && s.references(kindRecipe, c.parentRefs[key]) {
+				s.add(kindRecipe, key)
+				added = true
+			}
+		}
+	}
+	for key := range c.apps {
+		refs := c.appRefs[key]
+		if s.references(kindTemplate, refs.template) {
+			s.add(kindApplication, key)
+			continue
+		}
+		for _, ref := range refs.recipes {
+			if s.references(kindRecipe, ref) {
+				s.add(kindApplication, key)
+				break
+			}
+		}
+	}
+}
+
+// references tells if ref may designate an item of kind in set
+func (s itemSet) references(kind string, ref string) bool {
+	if ref == "" {
+		return false
+	}
+	for key := range s[kind] {
+		if terraGitModel.References(ref, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// sinceScope returns the files of targetDir to report on: the items changed since ref and their dependents
+func sinceScope(targetDir string, ref string) (func(file string) bool, error) {
+	items, err := changedItems(targetDir, ref)
+	if err != nil {
+		return nil, err
+	}
+	c, err := loadCatalog(targetDir)
+	if err != nil {
+		return nil, err
+	}
+	items.addDependents(c)
+	return func(file string) bool {
+		rel, relErr := filepath.Rel(targetDir, file)
+		if relErr != nil {
+			return false
+		}
+		kind, key, ok := catalogItem(rel)
+		return ok && items.has(kind, key)
+	}, nil
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path"
+	"sort"
+
+	"github.com/hashicorp/hcl2/hcl"
+	"github.com/hashicorp/hcl2/hcl/hclsyntax"
+	terraGitModel "github.com/osallou/goterra-community/tools/model"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// parseTerraform parses a terraform file, syntax errors are returned as hcl.Diagnostics
+func parseTerraform(file string) (*hclsyntax.Body, error) {
+	src, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	f, diags := hclsyntax.ParseConfig(src, file, hcl.Pos{Line: 1, Column: 1})
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	return f.Body.(*hclsyntax.Body), nil
+}
+
+// terraformVariables returns the variables declared (variable blocks) and used (var.xx)
+// in a terraform file, with the position of their first occurrence
+func terraformVariables(file string) (declared map[string]hcl.Pos, used map[string]hcl.Pos, err error) {
+	body, err := parseTerraform(file)
+	if err != nil {
+		return nil, nil, err
+	}
+	declared = make(map[string]hcl.Pos)
+	used = make(map[string]hcl.Pos)
+	// Attributes are walked in no particular order, keep first position in file
+	first := func(vars map[string]hcl.Pos, name string, pos hcl.Pos) {
+		if prev, ok := vars[name]; !ok || pos.Byte < prev.Byte {
+			vars[name] = pos
+		}
+	}
+	hclsyntax.VisitAll(body, func(node hclsyntax.Node) hcl.Diagnostics {
+		switch n := node.(type) {
+		case *hclsyntax.Block:
+			if n.Type == "variable" && len(n.Labels) == 1 {
+				first(declared, n.Labels[0], n.LabelRanges[0].Start)
+			}
+		case *hclsyntax.ScopeTraversalExpr:
+			if n.Traversal.RootName() != "var" || len(n.Traversal) < 2 {
+				break
+			}
+			if attr, ok := n.Traversal[1].(hcl.TraverseAttr); ok {
+				first(used, attr.Name, n.SrcRange.Start)
+			}
+		}
+		return nil
+	})
+	return declared, used, nil
+}
+
+// templatePushKeys returns the goterra-cli keys written by the goterra_push resources of template files
+func templatePushKeys(t terraGitModel.Template) []*scriptKeys {
+	pushes := make([]*scriptKeys, 0)
+	for cloud, file := range t.Files {
+		tfFile := fmt.Sprintf("%s/%s/%s", path.Dir(t.Path), cloud, file)
+		body, err := parseTerraform(tfFile)
+		if err != nil {
+			continue
+		}
+		keys := &scriptKeys{file: tfFile, gets: make(map[string]int), puts: make([]string, 0)}
+		for _, block := range body.Blocks {
+			if block.Type != "resource" || len(block.Labels) == 0 || block.Labels[0] != "goterra_push" {
+				continue
+			}
+			attr, ok := block.Body.Attributes["key"]
+			if !ok {
+				continue
+			}
+			// Only literal keys are known before deployment
+			if key, diags := attr.Expr.Value(nil); !diags.HasErrors() && key.Type() == cty.String && key.IsKnown() && !key.IsNull() {
+				keys.puts = append(keys.puts, key.AsString())
+			}
+		}
+		pushes = append(pushes, keys)
+	}
+	return pushes
+}
+
+// checkTemplateVariables cross-checks template inputs and recipes variables against
+// the variables of its terraform files
+//
+// Inputs and recipes variables not used in a file are reported, as well as variables
+// used but declared nowhere (template, variable blocks, endpoints of cloud kind, goterra)
+func checkTemplateVariables(report *Report, t terraGitModel.Template, endpoints []terraGitModel.Endpoint) {
+	clouds := make([]string, 0, len(t.Files))
+	for cloud := range t.Files {
+		clouds = append(clouds, cloud)
+	}
+	sort.Strings(clouds)
+
+	for _, cloud := range clouds {
+		tfFile := fmt.Sprintf("%s/%s/%s", path.Dir(t.Path), cloud, t.Files[cloud])
+		declared, used, err := terraformVariables(tfFile)
+		if diags, ok := err.(hcl.Diagnostics); ok {
+			for _, diag := range diags {
+				line, column := 0, 0
+				if diag.Subject != nil {
+					line, column = diag.Subject.Start.Line, diag.Subject.Start.Column
+				}
+				report.AddAt(kindTemplate, tfFile, line, column, ruleTerraform, severityError, fmt.Sprintf("%s: %s", diag.Summary, diag.Detail))
+			}
+			continue
+		}
+		if err != nil {
+			// Missing files are reported by template check
+			continue
+		}
+
+		inputs := make([]string, 0, len(t.Inputs))
+		for input := range t.Inputs {
+			inputs = append(inputs, input)
+		}
+		sort.Strings(inputs)
+		for _, input := range inputs {
+			if _, ok := used[input]; !ok {
+				report.Add(kindTemplate, t.Path, 0, ruleInputUnused, severityWarning, fmt.Sprintf("input %s is not used in %s", input, tfFile))
+			}
+		}
+		for _, recipes := range t.Recipes {
+			if _, ok := used[recipes]; !ok {
+				report.Add(kindTemplate, t.Path, 0, ruleInputUnused, severityWarning, fmt.Sprintf("recipes variable %s is not used in %s", recipes, tfFile))
+			}
+		}
+
+		provided := make(map[string]bool)
+		for _, endpoint := range endpoints {
+			if endpoint.Kind != cloud {
+				continue
+			}
+			for key := range endpoint.Config {
+				provided[key] = true
+			}
+			for key := range endpoint.Inputs {
+				provided[key] = true
+			}
+			for key := range endpoint.Features {
+				provided[terraGitModel.FeaturePrefix+key] = true
+			}
+		}
+		vars := make([]string, 0, len(used))
+		for name := range used {
+			vars = append(vars, name)
+		}
+		sort.Strings(vars)
+		for _, name := range vars {
+			if _, ok := t.Inputs[name]; ok {
+				continue
+			}
+			if _, ok := declared[name]; ok {
+				continue
+			}
+			if provided[name] || terraGitModel.IsDeployVariable(name) {
+				continue
+			}
+			isRecipes := false
+			for _, recipes := range t.Recipes {
+				if recipes == name {
+					isRecipes = true
+				}
+			}
+			if isRecipes {
+				continue
+			}
+			report.AddAt(kindTemplate, tfFile, used[name].Line, used[name].Column, ruleVariableUndeclared, severityError, fmt.Sprintf("variable %s is used but not declared", name))
+		}
+	}
+}
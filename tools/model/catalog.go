@@ -0,0 +1,80 @@
+package goterragit
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// Catalog files are resolved from the catalog root, the directory containing
+// recipes, templates, endpoints and apps (git checkout for injector)
+
+// RecipeFile returns the definition file of recipe (name/version) in catalog root
+func RecipeFile(root string, recipe string) string {
+	return filepath.Join(root, "recipes", filepath.FromSlash(recipe), "recipe.yaml")
+}
+
+// TemplateFile returns the definition file of template (name/version) in catalog root
+func TemplateFile(root string, template string) string {
+	return filepath.Join(root, "templates", filepath.FromSlash(template), "template.yaml")
+}
+
+// ResolveRecipe returns the name/version of recipe referenced by ref in catalog root
+func ResolveRecipe(root string, ref string) (string, error) {
+	return resolveReference(root, "recipes", ref)
+}
+
+// ResolveTemplate returns the name/version of template referenced by ref in catalog root
+func ResolveTemplate(root string, ref string) (string, error) {
+	return resolveReference(root, "templates", ref)
+}
+
+// References tells if reference ref may designate item (name/version): ref is item, or a version
+// constraint on the name of item, whatever the versions in catalog
+func References(ref string, item string) bool {
+	elts := strings.SplitN(ref, "@", 2)
+	if len(elts) == 1 {
+		return ref == item
+	}
+	return strings.SplitN(item, "/", 2)[0] == elts[0]
+}
+
+// resolveReference returns the name/version of the item of dir (recipes or templates) referenced by ref
+//
+// A reference is either name/version, returned as is, or name@constraint, resolved to
+// the highest version of name in catalog root matching constraint
+func resolveReference(root string, dir string, ref string) (string, error) {
+	elts := strings.SplitN(ref, "@", 2)
+	if len(elts) == 1 {
+		return ref, nil
+	}
+	name := elts[0]
+	constraint, err := ParseConstraint(elts[1])
+	if err != nil {
+		return "", fmt.Errorf("invalid reference %s: %s", ref, err)
+	}
+	dirs, err := ioutil.ReadDir(filepath.Join(root, dir, name))
+	if err != nil {
+		return "", fmt.Errorf("invalid reference %s: %s not found", ref, name)
+	}
+	resolved := ""
+	var resolvedVersion Version
+	for _, versionDir := range dirs {
+		if !versionDir.IsDir() {
+			continue
+		}
+		v, versionErr := ParseVersion(versionDir.Name())
+		if versionErr != nil || !constraint.Match(v) {
+			continue
+		}
+		if resolved == "" || v.Compare(resolvedVersion) > 0 {
+			resolved = versionDir.Name()
+			resolvedVersion = v
+		}
+	}
+	if resolved == "" {
+		return "", fmt.Errorf("invalid reference %s: no version of %s matches %s", ref, name, elts[1])
+	}
+	return name + "/" + resolved, nil
+}
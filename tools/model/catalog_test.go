@@ -0,0 +1,75 @@
+package goterragit
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestResolveReference(t *testing.T) {
+	root, err := ioutil.TempDir("", "goterra-catalog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	for _, dir := range []string{"v1.0", "v1.2", "v1.10", "v2.0-beta", "v0.1", "notaversion"} {
+		if err := os.MkdirAll(filepath.Join(root, "recipes", "disk", dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ioutil.WriteFile(filepath.Join(root, "recipes", "disk", "v9.0"), []byte{}, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		ref  string
+		want string
+		err  string
+	}{
+		{ref: "disk/v1.0", want: "disk/v1.0"},
+		{ref: "other/v3.0", want: "other/v3.0"},
+		{ref: "disk@latest", want: "disk/v1.10"},
+		{ref: "disk@^1.0", want: "disk/v1.10"},
+		{ref: "disk@~1.2", want: "disk/v1.2"},
+		{ref: "disk@v1.0", want: "disk/v1.0"},
+		{ref: "disk@=v2.0-beta", want: "disk/v2.0-beta"},
+		{ref: "disk@^0.1", want: "disk/v0.1"},
+		{ref: "disk@^2.0", err: "no version of disk matches ^2.0"},
+		{ref: "disk@v9.0", err: "no version of disk matches v9.0"},
+		{ref: "missing@latest", err: "missing not found"},
+		{ref: "disk@>1.0", err: "invalid version >1.0"},
+	}
+	for _, test := range tests {
+		got, err := resolveReference(root, "recipes", test.ref)
+		if test.err != "" {
+			if err == nil || !strings.HasPrefix(err.Error(), "invalid reference "+test.ref) || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("resolveReference(%q) = %q, %v, want error %s", test.ref, got, err, test.err)
+			}
+			continue
+		}
+		if err != nil || got != test.want {
+			t.Errorf("resolveReference(%q) = %q, %v, want %q", test.ref, got, err, test.want)
+		}
+	}
+}
+
+func TestReferences(t *testing.T) {
+	tests := []struct {
+		ref  string
+		item string
+		want bool
+	}{
+		{ref: "disk/v1.0", item: "disk/v1.0", want: true},
+		{ref: "disk/v1.0", item: "disk/v1.1", want: false},
+		{ref: "disk@latest", item: "disk/v1.1", want: true},
+		{ref: "disk@^1.0", item: "disk/v2.0", want: true},
+		{ref: "disk@latest", item: "disk_block/v1.0", want: false},
+	}
+	for _, test := range tests {
+		if got := References(test.ref, test.item); got != test.want {
+			t.Errorf("References(%q, %q) = %t, want %t", test.ref, test.item, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package goterragit
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// DecodeError is an error of a definition file, line and column are 0 if unknown
+type DecodeError struct {
+	File    string
+	Line    int
+	Column  int
+	Path    string
+	Message string
+}
+
+func (e *DecodeError) Error() string {
+	msg := e.Message
+	if e.Path != "" {
+		msg = e.Path + ": " + msg
+	}
+	return fmt.Sprintf("%s:%d:%d: %s", e.File, e.Line, e.Column, msg)
+}
+
+// DecodeErrors are the unknown keys, duplicate keys and values of wrong type of a definition file
+type DecodeErrors []*DecodeError
+
+func (errs DecodeErrors) Error() string {
+	msgs := make([]string, 0, len(errs))
+	for _, err := range errs {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// syntaxLine matches line number in yaml syntax errors
+var syntaxLine = regexp.MustCompile(`^yaml: line (\d+): `)
+
+// Decode strictly reads definition file data in def, a pointer to a RecipeDefinition,
+// TemplateDefinition, EndpointDefinition or ApplicationDefinition
+//
+// Syntax errors are returned as a *DecodeError, unknown keys, duplicate keys and values
+// of wrong type as DecodeErrors
+func Decode(file string, data []byte, def interface{}) error {
+	kind := ""
+	for k, d := range definitions {
+		if reflect.TypeOf(def) == reflect.PtrTo(reflect.TypeOf(d)) {
+			kind = k
+		}
+	}
+	if kind == "" {
+		return fmt.Errorf("cannot decode definition in %T", def)
+	}
+	var doc yamlv3.Node
+	if err := yamlv3.Unmarshal(data, &doc); err != nil {
+		syntaxErr := &DecodeError{File: file, Message: err.Error()}
+		if match := syntaxLine.FindStringSubmatch(err.Error()); match != nil {
+			syntaxErr.Line, _ = strconv.Atoi(match[1])
+			syntaxErr.Message = strings.TrimPrefix(err.Error(), match[0])
+		}
+		return syntaxErr
+	}
+	root := &doc
+	if doc.Kind == yamlv3.DocumentNode && len(doc.Content) > 0 {
+		root = doc.Content[0]
+	}
+	s, _ := DefinitionSchema(kind)
+	errs := make(DecodeErrors, 0)
+	s.validate("", root, &errs)
+	if len(errs) > 0 {
+		for _, err := range errs {
+			err.File = file
+		}
+		return errs
+	}
+	return yaml.Unmarshal(data, def)
+}
+
+// fieldPart matches a key of a field path with its optional indexes, like slot[0]
+var fieldPart = regexp.MustCompile(`^([^\[]*)((?:\[\d+\])*)$`)
+
+// fieldIndex matches the indexes of a field path key
+var fieldIndex = regexp.MustCompile(`\d+`)
+
+// FieldPosition returns the line and column of field in definition file data, field being
+// a path like recipe.inputs.size or application.recipes.slot[0]
+//
+// Position is the one of the closest parent if field is not set, 0 if data is not valid yaml
+func FieldPosition(data []byte, field string) (int, int) {
+	var doc yamlv3.Node
+	if err := yamlv3.Unmarshal(data, &doc); err != nil || len(doc.Content) == 0 {
+		return 0, 0
+	}
+	node := doc.Content[0]
+	line, column := node.Line, node.Column
+	if field == "" {
+		return line, column
+	}
+	for _, part := range strings.Split(field, ".") {
+		match := fieldPart.FindStringSubmatch(part)
+		if match == nil || node.Kind != yamlv3.MappingNode {
+			return line, column
+		}
+		var value *yamlv3.Node
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == match[1] {
+				line, column = node.Content[i].Line, node.Content[i].Column
+				value = node.Content[i+1]
+				break
+			}
+		}
+		if value == nil {
+			return line, column
+		}
+		node = value
+		for _, index := range fieldIndex.FindAllString(match[2], -1) {
+			i, _ := strconv.Atoi(index)
+			if node.Kind != yamlv3.SequenceNode || i >= len(node.Content) {
+				return line, column
+			}
+			node = node.Content[i]
+			line, column = node.Line, node.Column
+		}
+	}
+	return line, column
+}
@@ -0,0 +1,133 @@
+package goterragit
+
+import (
+	"testing"
+)
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		errs []string
+	}{
+		{
+			name: "valid",
+			data: "recipe:\n  name: test\n  license: Apache-2.0\n  inputs:\n    size: size of disk\n",
+		},
+		{
+			name: "scalars as strings",
+			data: "recipe:\n  name: test\n  license: Apache-2.0\n  description: yes\n  defaults:\n    count: [2, 1.5, true]\n",
+		},
+		{
+			name: "unknown key",
+			data: "recipe:\n  name: test\n  license: Apache-2.0\n  parents: base/v1.0\n",
+			errs: []string{"recipe.yaml:4:3: recipe.parents: unknown key"},
+		},
+		{
+			name: "duplicate key",
+			data: "recipe:\n  name: test\n  license: Apache-2.0\n  name: other\n",
+			errs: []string{"recipe.yaml:4:3: recipe.name: duplicate key, already defined at line 2"},
+		},
+		{
+			name: "wrong type",
+			data: "recipe:\n  name: test\n  license: Apache-2.0\n  base: debian\n  tags:\n    - [a, b]\n",
+			errs: []string{
+				"recipe.yaml:4:9: recipe.base: expected array or null, got string",
+				"recipe.yaml:6:7: recipe.tags[0]: expected string, got array",
+			},
+		},
+		{
+			name: "input form",
+			data: "recipe:\n  name: test\n  license: Apache-2.0\n  inputs:\n    size:\n      type: float\n      min: ten\n",
+			errs: []string{
+				"recipe.yaml:6:13: recipe.inputs.size.type: float is not one of string, int, bool, enum, secret",
+				"recipe.yaml:7:12: recipe.inputs.size.min: expected integer or null, got string",
+			},
+		},
+		{
+			name: "missing root key",
+			data: "template:\n  name: test\n",
+			errs: []string{
+				"recipe.yaml:1:1: missing key recipe",
+				"recipe.yaml:1:1: template: unknown key",
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			def := RecipeDefinition{}
+			err := Decode("recipe.yaml", []byte(test.data), &def)
+			if len(test.errs) == 0 {
+				if err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+				return
+			}
+			errs, ok := err.(DecodeErrors)
+			if !ok {
+				t.Fatalf("err = %v, want DecodeErrors", err)
+			}
+			got := make(map[string]bool)
+			for _, e := range errs {
+				got[e.Error()] = true
+			}
+			for _, want := range test.errs {
+				if !got[want] {
+					t.Errorf("missing error %s in %v", want, errs)
+				}
+			}
+			if len(errs) != len(test.errs) {
+				t.Errorf("errs = %v, want %v", errs, test.errs)
+			}
+		})
+	}
+}
+
+func TestDecodeSyntaxError(t *testing.T) {
+	def := RecipeDefinition{}
+	err := Decode("recipe.yaml", []byte("recipe:\n  name: test\n   license: x\n"), &def)
+	syntaxErr, ok := err.(*DecodeError)
+	if !ok {
+		t.Fatalf("err = %v, want *DecodeError", err)
+	}
+	if syntaxErr.File != "recipe.yaml" || syntaxErr.Line != 3 {
+		t.Errorf("err = %s, want error at recipe.yaml line 3", syntaxErr)
+	}
+}
+
+func TestFieldPosition(t *testing.T) {
+	data := []byte(`application:
+  name: test
+  recipes:
+    slot:
+      - a/v1.0
+      - b/v1.0
+  inputs:
+    size: "size"
+`)
+	tests := []struct {
+		field  string
+		line   int
+		column int
+	}{
+		{field: "", line: 1, column: 1},
+		{field: "application.name", line: 2, column: 3},
+		{field: "application.recipes.slot", line: 4, column: 5},
+		{field: "application.recipes.slot[1]", line: 6, column: 9},
+		{field: "application.inputs.size", line: 8, column: 5},
+		// Closest parent of unset fields
+		{field: "application.license", line: 1, column: 1},
+		{field: "application.inputs.count", line: 7, column: 3},
+		{field: "application.recipes.slot[5]", line: 4, column: 5},
+		{field: "application.name.first", line: 2, column: 3},
+	}
+	for _, test := range tests {
+		line, column := FieldPosition(data, test.field)
+		if line != test.line || column != test.column {
+			t.Errorf("FieldPosition(%q) = %d:%d, want %d:%d", test.field, line, column, test.line, test.column)
+		}
+	}
+	if line, column := FieldPosition([]byte("a: [b"), "a"); line != 0 || column != 0 {
+		t.Errorf("FieldPosition of invalid yaml = %d:%d, want 0:0", line, column)
+	}
+}
@@ -0,0 +1,28 @@
+package goterragit
+
+import (
+	"strings"
+)
+
+// DeployVariables are the terraform variables set by goterra on deployment, in addition
+// to the template inputs and the config, inputs and features of endpoint
+var DeployVariables = []string{"user_name", "password", "image_id"}
+
+// DeployPrefix is the prefix of goterra variables (goterra_url, goterra_apikey, ...)
+const DeployPrefix = "goterra_"
+
+// FeaturePrefix is the prefix of the variables of endpoint features (feature_ip_public, ...)
+const FeaturePrefix = "feature_"
+
+// IsDeployVariable tells if terraform variable name is set by goterra on deployment
+func IsDeployVariable(name string) bool {
+	if strings.HasPrefix(name, DeployPrefix) {
+		return true
+	}
+	for _, variable := range DeployVariables {
+		if variable == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,76 @@
+package goterragit
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Finding severities
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// Check rule ids
+const (
+	RuleMissingField   = "missing-field"
+	RuleInput          = "input"
+	RuleParentNotFound = "parent-not-found"
+	RuleFileNotFound   = "file-not-found"
+	RuleRecipeSlot     = "recipe-slot"
+	RuleReference      = "reference"
+)
+
+// Finding is a problem found by the check of a definition
+//
+// Field is the path of the field in definition file, like recipe.inputs.size
+type Finding struct {
+	Rule     string `json:"rule"`
+	Severity string `json:"severity"`
+	Field    string `json:"field"`
+	Message  string `json:"message"`
+}
+
+func (f Finding) Error() string {
+	return fmt.Sprintf("%s: %s", f.Field, f.Message)
+}
+
+// Findings are the problems found by the check of a definition
+type Findings []Finding
+
+// errorf adds an error on field
+func (findings *Findings) errorf(rule string, field string, format string, args ...interface{}) {
+	*findings = append(*findings, Finding{Rule: rule, Severity: SeverityError, Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// warnf adds a warning on field
+func (findings *Findings) warnf(rule string, field string, format string, args ...interface{}) {
+	*findings = append(*findings, Finding{Rule: rule, Severity: SeverityWarning, Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// HasErrors tells if a finding is an error
+func (findings Findings) HasErrors() bool {
+	return findings.Err() != nil
+}
+
+// Err returns the findings with error severity, nil if there are none
+func (findings Findings) Err() error {
+	errs := make(Findings, 0)
+	for _, f := range findings {
+		if f.Severity == SeverityError {
+			errs = append(errs, f)
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+func (findings Findings) Error() string {
+	msgs := make([]string, 0, len(findings))
+	for _, f := range findings {
+		msgs = append(msgs, f.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
@@ -0,0 +1,221 @@
+package goterragit
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+// Input types
+const (
+	InputString = "string"
+	InputInt    = "int"
+	InputBool   = "bool"
+	InputEnum   = "enum"
+	InputSecret = "secret"
+)
+
+// Input defines an input of a recipe, template or endpoint
+//
+// In yaml, an input is either a description string (a string input) or a mapping
+// with description, type, required, default, regex, min, max and values.
+// Min and max are bounds of value for int inputs, of length for string and secret inputs.
+// Required inputs cannot be empty, deployments must set them if they have no default
+type Input struct {
+	Description string   `yaml:"description" json:"description"`
+	Type        string   `yaml:"type,omitempty" json:"type,omitempty"`
+	Required    bool     `yaml:"required,omitempty" json:"required,omitempty"`
+	Default     string   `yaml:"default,omitempty" json:"default,omitempty"`
+	Regex       string   `yaml:"regex,omitempty" json:"regex,omitempty"`
+	Min         *int     `yaml:"min,omitempty" json:"min,omitempty"`
+	Max         *int     `yaml:"max,omitempty" json:"max,omitempty"`
+	Values      []string `yaml:"values,omitempty" json:"values,omitempty"`
+}
+
+// Inputs are the inputs of a recipe, template or endpoint, by name
+type Inputs map[string]Input
+
+// UnmarshalYAML reads an input from a description string or a mapping
+func (in *Input) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var description string
+	if err := unmarshal(&description); err == nil {
+		*in = Input{Description: description}
+		return nil
+	}
+	type plain Input
+	var def plain
+	if err := unmarshal(&def); err != nil {
+		return err
+	}
+	*in = Input(def)
+	return nil
+}
+
+// MarshalYAML writes inputs with only a description as a string
+func (in Input) MarshalYAML() (interface{}, error) {
+	if in.isPlain() {
+		return in.Description, nil
+	}
+	type plain Input
+	return plain(in), nil
+}
+
+// isPlain tells if input is only a description
+func (in Input) isPlain() bool {
+	return in.Type == "" && !in.Required && in.Default == "" && in.Regex == "" && in.Min == nil && in.Max == nil && len(in.Values) == 0
+}
+
+// kind returns input type, string if not set
+func (in Input) kind() string {
+	if in.Type == "" {
+		return InputString
+	}
+	return in.Type
+}
+
+// Check validates input definition, and its default value
+func (in Input) Check() error {
+	switch in.kind() {
+	case InputString, InputSecret, InputInt:
+	case InputBool:
+		if in.Regex != "" || in.Min != nil || in.Max != nil || len(in.Values) > 0 {
+			return fmt.Errorf("bool input cannot have regex, min, max or values")
+		}
+	case InputEnum:
+		if len(in.Values) == 0 {
+			return fmt.Errorf("enum input has no values")
+		}
+	default:
+		return fmt.Errorf("unknown type %s, expecting string, int, bool, enum or secret", in.Type)
+	}
+	if in.Regex != "" {
+		if _, err := regexp.Compile(in.Regex); err != nil {
+			return fmt.Errorf("invalid regex: %s", err)
+		}
+	}
+	if in.Min != nil && in.Max != nil && *in.Min > *in.Max {
+		return fmt.Errorf("min %d is greater than max %d", *in.Min, *in.Max)
+	}
+	if in.Default != "" {
+		if err := in.Validate(in.Default); err != nil {
+			return fmt.Errorf("invalid default: %s", err)
+		}
+	}
+	return nil
+}
+
+// Validate checks value is valid for input
+func (in Input) Validate(value string) error {
+	if value == "" {
+		if in.Required {
+			return fmt.Errorf("value is required")
+		}
+		// Optional inputs may be left unset
+		return nil
+	}
+	size := len(value)
+	switch in.kind() {
+	case InputInt:
+		i, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%s is not an int", value)
+		}
+		size = i
+	case InputBool:
+		if _, err := strconv.ParseBool(value); err != nil {
+			return fmt.Errorf("%s is not a bool", value)
+		}
+		return nil
+	}
+	if len(in.Values) > 0 {
+		allowed := false
+		for _, v := range in.Values {
+			if v == value {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return fmt.Errorf("%s is not one of %v", value, in.Values)
+		}
+	}
+	if in.Regex != "" {
+		re, err := regexp.Compile(in.Regex)
+		if err != nil {
+			return fmt.Errorf("invalid regex: %s", err)
+		}
+		if !re.MatchString(value) {
+			return fmt.Errorf("%s does not match %s", value, in.Regex)
+		}
+	}
+	if in.Min != nil && size < *in.Min {
+		if in.kind() == InputInt {
+			return fmt.Errorf("%s is lower than %d", value, *in.Min)
+		}
+		return fmt.Errorf("%s is shorter than %d", value, *in.Min)
+	}
+	if in.Max != nil && size > *in.Max {
+		if in.kind() == InputInt {
+			return fmt.Errorf("%s is greater than %d", value, *in.Max)
+		}
+		return fmt.Errorf("%s is longer than %d", value, *in.Max)
+	}
+	return nil
+}
+
+// names returns input names, sorted
+func (inputs Inputs) names() []string {
+	names := make([]string, 0, len(inputs))
+	for name := range inputs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Check validates input definitions, field is the path of inputs in definition
+func (inputs Inputs) Check(field string) Findings {
+	findings := make(Findings, 0)
+	for _, name := range inputs.names() {
+		if err := inputs[name].Check(); err != nil {
+			findings.errorf(RuleInput, field+"."+name, "%s", err)
+		}
+	}
+	return findings
+}
+
+// CheckDefaults validates the default values of inputs (defaults section) against their definition
+//
+// Defaults of inputs not defined in inputs are ignored
+func (inputs Inputs) CheckDefaults(defaults map[string][]string) []error {
+	errs := make([]error, 0)
+	for _, name := range inputs.names() {
+		for _, value := range defaults[name] {
+			if err := inputs[name].Validate(value); err != nil {
+				errs = append(errs, fmt.Errorf("Default of input %s: %s", name, err))
+			}
+		}
+	}
+	return errs
+}
+
+// Unset returns the required inputs with no default value, neither in their definition nor in defaults section
+func (inputs Inputs) Unset(defaults map[string][]string) []string {
+	unset := make([]string, 0)
+	for _, name := range inputs.names() {
+		if inputs[name].Required && inputs[name].Default == "" && len(defaults[name]) == 0 {
+			unset = append(unset, name)
+		}
+	}
+	return unset
+}
+
+// Descriptions returns input descriptions, the plain form of inputs
+func (inputs Inputs) Descriptions() map[string]string {
+	descriptions := make(map[string]string)
+	for name, input := range inputs {
+		descriptions[name] = input.Description
+	}
+	return descriptions
+}
@@ -0,0 +1,131 @@
+package goterragit
+
+import (
+	"reflect"
+	"testing"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+func intPtr(i int) *int {
+	return &i
+}
+
+func TestInputValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		input Input
+		value string
+		ok    bool
+	}{
+		{name: "string", input: Input{}, value: "any", ok: true},
+		{name: "optional unset", input: Input{}, value: "", ok: true},
+		{name: "required unset", input: Input{Required: true}, value: "", ok: false},
+		{name: "optional int unset", input: Input{Type: InputInt}, value: "", ok: true},
+		{name: "optional enum unset", input: Input{Type: InputEnum, Values: []string{"a", "b"}}, value: "", ok: true},
+		{name: "required int unset", input: Input{Type: InputInt, Required: true}, value: "", ok: false},
+		{name: "int", input: Input{Type: InputInt}, value: "12", ok: true},
+		{name: "not an int", input: Input{Type: InputInt}, value: "twelve", ok: false},
+		{name: "int min", input: Input{Type: InputInt, Min: intPtr(1)}, value: "0", ok: false},
+		{name: "int max", input: Input{Type: InputInt, Max: intPtr(10)}, value: "11", ok: false},
+		{name: "int in bounds", input: Input{Type: InputInt, Min: intPtr(1), Max: intPtr(10)}, value: "10", ok: true},
+		{name: "string min length", input: Input{Min: intPtr(3)}, value: "ab", ok: false},
+		{name: "string max length", input: Input{Max: intPtr(3)}, value: "abcd", ok: false},
+		{name: "secret length", input: Input{Type: InputSecret, Min: intPtr(8)}, value: "12345678", ok: true},
+		{name: "bool", input: Input{Type: InputBool}, value: "true", ok: true},
+		{name: "not a bool", input: Input{Type: InputBool}, value: "maybe", ok: false},
+		{name: "enum", input: Input{Type: InputEnum, Values: []string{"a", "b"}}, value: "b", ok: true},
+		{name: "not in enum", input: Input{Type: InputEnum, Values: []string{"a", "b"}}, value: "c", ok: false},
+		{name: "regex", input: Input{Regex: "^[a-z]+$"}, value: "abc", ok: true},
+		{name: "regex mismatch", input: Input{Regex: "^[a-z]+$"}, value: "ABC", ok: false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.input.Validate(test.value)
+			if test.ok && err != nil {
+				t.Errorf("Validate(%q) unexpected error: %s", test.value, err)
+			}
+			if !test.ok && err == nil {
+				t.Errorf("Validate(%q) expected an error", test.value)
+			}
+		})
+	}
+}
+
+func TestInputCheck(t *testing.T) {
+	tests := []struct {
+		name  string
+		input Input
+		ok    bool
+	}{
+		{name: "description only", input: Input{Description: "size"}, ok: true},
+		{name: "unknown type", input: Input{Type: "float"}, ok: false},
+		{name: "enum without values", input: Input{Type: InputEnum}, ok: false},
+		{name: "bool with regex", input: Input{Type: InputBool, Regex: "^t"}, ok: false},
+		{name: "invalid regex", input: Input{Regex: "("}, ok: false},
+		{name: "min greater than max", input: Input{Type: InputInt, Min: intPtr(5), Max: intPtr(1)}, ok: false},
+		{name: "invalid default", input: Input{Type: InputInt, Default: "abc"}, ok: false},
+		{name: "valid default", input: Input{Type: InputInt, Default: "3", Min: intPtr(1)}, ok: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.input.Check()
+			if test.ok && err != nil {
+				t.Errorf("Check() unexpected error: %s", err)
+			}
+			if !test.ok && err == nil {
+				t.Errorf("Check() expected an error")
+			}
+		})
+	}
+}
+
+func TestInputsUnmarshalYAML(t *testing.T) {
+	data := []byte(`
+size: "size of volume"
+count:
+  description: number of nodes
+  type: int
+  required: true
+  default: "2"
+  min: 1
+  max: 10
+flavor:
+  type: enum
+  values: [small, large]
+`)
+	var inputs Inputs
+	if err := yaml.Unmarshal(data, &inputs); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	want := Inputs{
+		"size":   {Description: "size of volume"},
+		"count":  {Description: "number of nodes", Type: InputInt, Required: true, Default: "2", Min: intPtr(1), Max: intPtr(10)},
+		"flavor": {Type: InputEnum, Values: []string{"small", "large"}},
+	}
+	if !reflect.DeepEqual(inputs, want) {
+		t.Errorf("inputs = %+v, want %+v", inputs, want)
+	}
+}
+
+func TestInputsMarshalYAML(t *testing.T) {
+	inputs := Inputs{
+		"size":  {Description: "size of volume"},
+		"count": {Description: "number of nodes", Type: InputInt, Min: intPtr(1)},
+	}
+	data, err := yaml.Marshal(inputs)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	want := "count:\n  description: number of nodes\n  type: int\n  min: 1\nsize: size of volume\n"
+	if string(data) != want {
+		t.Errorf("yaml = %q, want %q", data, want)
+	}
+	var read Inputs
+	if err := yaml.Unmarshal(data, &read); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !reflect.DeepEqual(read, inputs) {
+		t.Errorf("round trip = %+v, want %+v", read, inputs)
+	}
+}
@@ -2,8 +2,11 @@ package goterragit
 
 import (
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path"
+	"sort"
+	"strings"
 
 	terraModel "github.com/osallou/goterra-lib/lib/model"
 	"github.com/rs/zerolog/log"
@@ -21,23 +24,30 @@ type Application struct {
 	Defaults    map[string][]string `yaml:"defaults"`
 }
 
+// MaxRecipeDepth is the max number of ancestors of a recipe, 0 for no limit
+var MaxRecipeDepth = 10
+
 // checkRecipeImage checks (sub)recipe exists, returns base image of recipe
+//
+// Parent cycles and inheritance deeper than MaxRecipeDepth are errors
 func checkRecipeImage(recdb terraModel.Recipe, recipes map[string]terraModel.Recipe) ([]string, error) {
-	if recdb.ParentRecipe != "" {
-		parentFound := false
-		var parentRecipe terraModel.Recipe
-		if recipe, ok := recipes[recdb.ParentRecipe]; ok {
-			parentRecipe = recipe
-			parentFound = true
+	recipePath := []string{recdb.Remote + "/" + recdb.RemoteVersion}
+	visited := map[string]int{recipePath[0]: 0}
+	for recdb.ParentRecipe != "" {
+		if i, ok := visited[recdb.ParentRecipe]; ok {
+			cycle := append(recipePath[i:], recdb.ParentRecipe)
+			return nil, fmt.Errorf("parent cycle %s", strings.Join(cycle, " -> "))
 		}
-		if !parentFound {
-			return nil, fmt.Errorf("parent recipe not found %s", recdb.ParentRecipe)
+		if MaxRecipeDepth > 0 && len(recipePath) > MaxRecipeDepth {
+			return nil, fmt.Errorf("recipe %s has more than %d ancestors: %s -> %s", recipePath[0], MaxRecipeDepth, strings.Join(recipePath, " -> "), recdb.ParentRecipe)
 		}
-		parentImage, err := checkRecipeImage(parentRecipe, recipes)
-		if err != nil {
-			return nil, err
+		parentRecipe, ok := recipes[recdb.ParentRecipe]
+		if !ok {
+			return nil, fmt.Errorf("parent recipe not found %s", recdb.ParentRecipe)
 		}
-		return parentImage, nil
+		visited[recdb.ParentRecipe] = len(recipePath)
+		recipePath = append(recipePath, recdb.ParentRecipe)
+		recdb = parentRecipe
 	}
 	if recdb.BaseImages == nil || len(recdb.BaseImages) == 0 {
 		return nil, fmt.Errorf("recipe has no base image nor parent recipe")
@@ -46,6 +56,11 @@ func checkRecipeImage(recdb terraModel.Recipe, recipes map[string]terraModel.Rec
 
 }
 
+// GetRecipeBaseImages returns base images of recipe, inherited from its ancestors if it has a parent
+func GetRecipeBaseImages(recipe terraModel.Recipe, recipes map[string]terraModel.Recipe) ([]string, error) {
+	return checkRecipeImage(recipe, recipes)
+}
+
 func removeDuplicates(elements []string) []string {
 	encountered := map[string]bool{}
 	result := []string{}
@@ -80,7 +95,7 @@ func intersection(s1, s2 []string) (inter []string) {
 	return
 }
 
-//Remove dups from slice.
+// Remove dups from slice.
 func removeDups(elements []string) (nodups []string) {
 	encountered := make(map[string]bool)
 	for _, element := range elements {
@@ -150,14 +165,19 @@ func (r *Application) GetAppBaseImages(appRecipes []terraModel.Recipe, recipes m
 	return possibleBaseImages, nil
 }
 
-// Check validates a recipe
-func (r *Application) Check() ([]string, error) {
+// Check validates an application, returns expected recipes and findings
+//
+// Recipe slots are checked against the recipes variables of template, in catalog root, a warning
+// is reported if template cannot be read
+func (r *Application) Check(root string) ([]string, Findings) {
+	findings := make(Findings, 0)
 	if r.Name == "" {
-		return nil, fmt.Errorf("Missing name")
+		findings.errorf(RuleMissingField, "application.name", "Missing name")
 	}
 	if r.Template == " " {
-		return nil, fmt.Errorf("Missing template")
+		findings.errorf(RuleMissingField, "application.template", "Missing template")
 	}
+	findings = append(findings, r.Resolve(root)...)
 	expectedRecipes := make([]string, 0)
 	if r.Recipes != nil {
 		for _, recipes := range r.Recipes {
@@ -165,7 +185,90 @@ func (r *Application) Check() ([]string, error) {
 		}
 	}
 
-	return expectedRecipes, nil
+	findings = append(findings, r.checkRecipeSlots(root)...)
+
+	return expectedRecipes, findings
+}
+
+// Resolve replaces the version constraints of template and recipes references by the matching versions in catalog root
+//
+// References which cannot be resolved are kept as is
+func (r *Application) Resolve(root string) Findings {
+	findings := make(Findings, 0)
+	if r.Template != "" {
+		template, err := ResolveTemplate(root, r.Template)
+		if err != nil {
+			findings.errorf(RuleReference, "application.template", "%s", err)
+		} else {
+			r.Template = template
+		}
+	}
+	slots := make([]string, 0, len(r.Recipes))
+	for slot := range r.Recipes {
+		slots = append(slots, slot)
+	}
+	sort.Strings(slots)
+	for _, slot := range slots {
+		for i, ref := range r.Recipes[slot] {
+			recipe, err := ResolveRecipe(root, ref)
+			if err != nil {
+				findings.errorf(RuleReference, fmt.Sprintf("application.recipes.%s[%d]", slot, i), "%s", err)
+				continue
+			}
+			r.Recipes[slot][i] = recipe
+		}
+	}
+	return findings
+}
+
+// loadTemplate reads the template of application in catalog root
+func (r *Application) loadTemplate(root string) (*Template, error) {
+	file := TemplateFile(root, r.Template)
+	yamlTemplate, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	t := TemplateDefinition{}
+	if err := Decode(file, yamlTemplate, &t); err != nil {
+		return nil, err
+	}
+	return &t.Template, nil
+}
+
+// checkRecipeSlots checks application recipes keys are recipes variables of template
+//
+// Unknown slots are errors, template slots without recipes are warnings, as well as a template
+// that cannot be read, slots are not checked then
+func (r *Application) checkRecipeSlots(root string) Findings {
+	findings := make(Findings, 0)
+	if r.Template == "" {
+		return findings
+	}
+	template, err := r.loadTemplate(root)
+	if err != nil {
+		findings.warnf(RuleRecipeSlot, "application.template", "Cannot check recipe slots, failed to read template %s: %s", r.Template, err)
+		return findings
+	}
+	slots := make(map[string]bool)
+	for _, slot := range template.Recipes {
+		slots[slot] = true
+	}
+	appSlots := make([]string, 0, len(r.Recipes))
+	for slot := range r.Recipes {
+		appSlots = append(appSlots, slot)
+	}
+	sort.Strings(appSlots)
+	for _, slot := range appSlots {
+		if !slots[slot] {
+			findings.errorf(RuleRecipeSlot, "application.recipes."+slot, "Unknown recipe slot %s, template %s declares %v", slot, r.Template, template.Recipes)
+		}
+	}
+	for _, slot := range template.Recipes {
+		if len(r.Recipes[slot]) == 0 {
+			findings.warnf(RuleRecipeSlot, "application.recipes", "No recipe in template slot %s", slot)
+		}
+	}
+	return findings
 }
 
 // ApplicationDefinition containers a recipe definition
@@ -180,7 +283,7 @@ type Endpoint struct {
 	Description string            `yaml:"description"`
 	Kind        string            `yaml:"kind"`
 	Features    map[string]string `yaml:"features"`
-	Inputs      map[string]string `yaml:"inputs"`
+	Inputs      Inputs            `yaml:"inputs"`
 	Config      map[string]string `yaml:"config"`
 	Images      map[string]string `yaml:"images"`
 	Tags        []string          `yaml:"tags"`
@@ -188,23 +291,25 @@ type Endpoint struct {
 	Defaults    map[string][]string `yaml:"defaults"`
 }
 
-// Check validates a recipe
-func (r *Endpoint) Check() error {
+// Check validates an endpoint
+func (r *Endpoint) Check() Findings {
+	findings := make(Findings, 0)
 	if r.Name == "" {
-		return fmt.Errorf("Missing name")
+		findings.errorf(RuleMissingField, "endpoint.name", "Missing name")
 	}
 	if r.Kind == " " {
-		return fmt.Errorf("Missing kind")
+		findings.errorf(RuleMissingField, "endpoint.kind", "Missing kind")
 	}
 	if len(r.Config) == 0 {
-		return fmt.Errorf("Missing config info")
+		findings.errorf(RuleMissingField, "endpoint.config", "Missing config info")
 	}
 	if len(r.Images) == 0 {
-		return fmt.Errorf("No image mapping defined")
+		findings.errorf(RuleMissingField, "endpoint.images", "No image mapping defined")
 
 	}
+	findings = append(findings, r.Inputs.Check("endpoint.inputs")...)
 
-	return nil
+	return findings
 }
 
 // EndpointDefinition containers a recipe definition
@@ -214,41 +319,58 @@ type EndpointDefinition struct {
 
 // Recipe defines the meta info for a recipe
 type Recipe struct {
-	Author      string            `yaml:"author"`
-	License     string            `yaml:"license"`
-	Name        string            `yaml:"name"`
-	Description string            `yaml:"description"`
-	Inputs      map[string]string `yaml:"inputs"`
-	Tags        []string          `yaml:"tags"`
-	Base        []string          `yaml:"base"`
-	Parent      string            `yaml:"parent"`
+	Author      string   `yaml:"author"`
+	License     string   `yaml:"license"`
+	Name        string   `yaml:"name"`
+	Description string   `yaml:"description"`
+	Inputs      Inputs   `yaml:"inputs"`
+	Tags        []string `yaml:"tags"`
+	Base        []string `yaml:"base"`
+	Parent      string   `yaml:"parent"`
 	Path        string
 	Defaults    map[string][]string `yaml:"defaults"`
 }
 
-// Check validates a recipe
-func (r *Recipe) Check() error {
+// Check validates a recipe, parent recipe is searched in catalog root
+func (r *Recipe) Check(root string) Findings {
+	findings := make(Findings, 0)
 	if r.Name == "" {
-		return fmt.Errorf("Missing name")
+		findings.errorf(RuleMissingField, "recipe.name", "Missing name")
 	}
 	if r.License == "" {
-		return fmt.Errorf("Missing license")
+		findings.errorf(RuleMissingField, "recipe.license", "Missing license")
 	}
 	if r.Inputs == nil {
-		r.Inputs = make(map[string]string)
+		r.Inputs = make(Inputs)
 	}
+	findings = append(findings, r.Inputs.Check("recipe.inputs")...)
 	if r.Tags == nil {
 		r.Tags = make([]string, 0)
 	}
 	if (r.Base == nil || len(r.Base) == 0) && r.Parent == "" {
-		return fmt.Errorf("Both base and parent are empty")
+		findings.errorf(RuleMissingField, "recipe.base", "Both base and parent are empty")
 	}
-	if r.Parent != "" {
-		parentRecipe := fmt.Sprintf("%s/recipe.yaml", r.Parent)
+	if err := r.Resolve(root); err != nil {
+		findings.errorf(RuleParentNotFound, "recipe.parent", "%s", err)
+	} else if r.Parent != "" {
+		parentRecipe := RecipeFile(root, r.Parent)
 		if _, err := os.Stat(parentRecipe); err != nil {
-			return fmt.Errorf("Parent recipe %s does not exists", parentRecipe)
+			findings.errorf(RuleParentNotFound, "recipe.parent", "Parent recipe %s does not exists", r.Parent)
 		}
 	}
+	return findings
+}
+
+// Resolve replaces the version constraint of parent reference by the matching version in catalog root
+func (r *Recipe) Resolve(root string) error {
+	if r.Parent == "" {
+		return nil
+	}
+	parent, err := ResolveRecipe(root, r.Parent)
+	if err != nil {
+		return err
+	}
+	r.Parent = parent
 	return nil
 }
 
@@ -263,7 +385,7 @@ type Template struct {
 	License     string            `yaml:"license"`
 	Name        string            `yaml:"name"`
 	Description string            `yaml:"description"`
-	Inputs      map[string]string `yaml:"inputs"`
+	Inputs      Inputs            `yaml:"inputs"`
 	Tags        []string          `yaml:"tags"`
 	Files       map[string]string `yaml:"files"`
 	Path        string
@@ -276,31 +398,44 @@ type TemplateDefinition struct {
 	Template Template `yaml:"template"`
 }
 
-// Check validates a recipe
-func (r *Template) Check() error {
+// Check validates a template
+func (r *Template) Check() Findings {
+	findings := make(Findings, 0)
 	if r.Name == "" {
-		return fmt.Errorf("Missing name")
+		findings.errorf(RuleMissingField, "template.name", "Missing name")
 	}
 	if r.License == "" {
-		return fmt.Errorf("Missing license")
+		findings.errorf(RuleMissingField, "template.license", "Missing license")
 	}
 	if r.Inputs == nil {
-		r.Inputs = make(map[string]string)
+		r.Inputs = make(Inputs)
+	}
+	findings = append(findings, r.Inputs.Check("template.inputs")...)
+	for _, name := range r.Inputs.names() {
+		if IsDeployVariable(name) {
+			findings.warnf(RuleInput, "template.inputs."+name, "input %s is set by goterra on deployment", name)
+		}
 	}
 	if r.Tags == nil {
 		r.Tags = make([]string, 0)
 	}
 	if r.Files == nil || len(r.Files) == 0 {
-		return fmt.Errorf("no files specified")
+		findings.errorf(RuleMissingField, "template.files", "no files specified")
 	}
 
-	for cloud, file := range r.Files {
+	clouds := make([]string, 0, len(r.Files))
+	for cloud := range r.Files {
+		clouds = append(clouds, cloud)
+	}
+	sort.Strings(clouds)
+	for _, cloud := range clouds {
+		file := r.Files[cloud]
 		filePath := fmt.Sprintf("%s/%s/%s", path.Dir(r.Path), cloud, file)
 		if _, err := os.Stat(filePath); err != nil {
-			return fmt.Errorf("File %s does not exists", file)
+			findings.errorf(RuleFileNotFound, "template.files."+cloud, "File %s does not exists", file)
 		}
 
 	}
 
-	return nil
+	return findings
 }
@@ -0,0 +1,54 @@
+package goterragit
+
+import (
+	"reflect"
+	"testing"
+
+	terraModel "github.com/osallou/goterra-lib/lib/model"
+)
+
+func TestCheckRecipeImage(t *testing.T) {
+	recipes := map[string]terraModel.Recipe{
+		"base/v1":    {Remote: "base", RemoteVersion: "v1", BaseImages: []string{"debian", "centos"}},
+		"child/v1":   {Remote: "child", RemoteVersion: "v1", ParentRecipe: "base/v1"},
+		"orphan/v1":  {Remote: "orphan", RemoteVersion: "v1", ParentRecipe: "missing/v1"},
+		"noimage/v1": {Remote: "noimage", RemoteVersion: "v1"},
+		"loop1/v1":   {Remote: "loop1", RemoteVersion: "v1", ParentRecipe: "loop2/v1"},
+		"loop2/v1":   {Remote: "loop2", RemoteVersion: "v1", ParentRecipe: "loop1/v1"},
+		"deep/v1":    {Remote: "deep", RemoteVersion: "v1", ParentRecipe: "child/v1"},
+	}
+	tests := []struct {
+		name     string
+		recipe   string
+		maxDepth int
+		images   []string
+		err      string
+	}{
+		{name: "base images", recipe: "base/v1", images: []string{"debian", "centos"}},
+		{name: "inherited images", recipe: "child/v1", images: []string{"debian", "centos"}},
+		{name: "parent not found", recipe: "orphan/v1", err: "parent recipe not found missing/v1"},
+		{name: "no base image", recipe: "noimage/v1", err: "recipe has no base image nor parent recipe"},
+		{name: "parent cycle", recipe: "loop1/v1", err: "parent cycle loop1/v1 -> loop2/v1 -> loop1/v1"},
+		{name: "depth limit", recipe: "deep/v1", maxDepth: 1, err: "recipe deep/v1 has more than 1 ancestors: deep/v1 -> child/v1 -> base/v1"},
+		{name: "depth within limit", recipe: "deep/v1", maxDepth: 2, images: []string{"debian", "centos"}},
+	}
+	defer func(depth int) { MaxRecipeDepth = depth }(MaxRecipeDepth)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			MaxRecipeDepth = test.maxDepth
+			images, err := checkRecipeImage(recipes[test.recipe], recipes)
+			if test.err != "" {
+				if err == nil || err.Error() != test.err {
+					t.Fatalf("err = %v, want %s", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !reflect.DeepEqual(images, test.images) {
+				t.Errorf("images = %v, want %v", images, test.images)
+			}
+		})
+	}
+}
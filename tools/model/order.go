@@ -0,0 +1,82 @@
+package goterragit
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// SortRecipes orders recipes so that a parent always comes before its children
+//
+// parents maps a recipe (name/version) to its parent recipe (name/version, empty if none).
+// Recipes with a missing parent, part of (or inheriting from) a parent cycle, or with more
+// than MaxRecipeDepth ancestors, are not in returned order, but in returned errors, keyed by recipe
+func SortRecipes(parents map[string]string) ([]string, map[string]error) {
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	state := make(map[string]int)
+	errs := make(map[string]error)
+	order := make([]string, 0, len(parents))
+	// depth is the number of ancestors of visited recipes
+	depth := make(map[string]int)
+
+	var visit func(recipe string, path []string) error
+	visit = func(recipe string, path []string) error {
+		switch state[recipe] {
+		case done:
+			return errs[recipe]
+		case visiting:
+			start := 0
+			for i, elt := range path {
+				if elt == recipe {
+					start = i
+					break
+				}
+			}
+			cycle := append(path[start:], recipe)
+			cycleErr := fmt.Errorf("parent cycle %s", strings.Join(cycle, " -> "))
+			for _, elt := range cycle {
+				errs[elt] = cycleErr
+			}
+			return cycleErr
+		}
+		state[recipe] = visiting
+		if parent := parents[recipe]; parent != "" {
+			if _, ok := parents[parent]; !ok {
+				errs[recipe] = fmt.Errorf("parent recipe %s not found", parent)
+			} else if parentErr := visit(parent, append(path, recipe)); parentErr != nil && errs[recipe] == nil {
+				errs[recipe] = fmt.Errorf("parent recipe %s is invalid: %s", parent, parentErr)
+			}
+		}
+		state[recipe] = done
+		if errs[recipe] != nil {
+			return errs[recipe]
+		}
+		if parent := parents[recipe]; parent != "" {
+			depth[recipe] = depth[parent] + 1
+		}
+		if MaxRecipeDepth > 0 && depth[recipe] > MaxRecipeDepth {
+			ancestry := []string{recipe}
+			for parent := parents[recipe]; parent != ""; parent = parents[parent] {
+				ancestry = append(ancestry, parent)
+			}
+			errs[recipe] = fmt.Errorf("recipe %s has more than %d ancestors: %s", recipe, MaxRecipeDepth, strings.Join(ancestry, " -> "))
+			return errs[recipe]
+		}
+		order = append(order, recipe)
+		return nil
+	}
+
+	recipes := make([]string, 0, len(parents))
+	for recipe := range parents {
+		recipes = append(recipes, recipe)
+	}
+	sort.Strings(recipes)
+	for _, recipe := range recipes {
+		visit(recipe, []string{})
+	}
+	return order, errs
+}
@@ -0,0 +1,91 @@
+package goterragit
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSortRecipes(t *testing.T) {
+	tests := []struct {
+		name    string
+		parents map[string]string
+		order   []string
+		errs    map[string]string
+	}{
+		{
+			name:    "no parent",
+			parents: map[string]string{"b/v1": "", "a/v1": ""},
+			order:   []string{"a/v1", "b/v1"},
+			errs:    map[string]string{},
+		},
+		{
+			name:    "parent first",
+			parents: map[string]string{"a/v1": "c/v1", "b/v1": "a/v1", "c/v1": ""},
+			order:   []string{"c/v1", "a/v1", "b/v1"},
+			errs:    map[string]string{},
+		},
+		{
+			name:    "parent not found",
+			parents: map[string]string{"a/v1": "missing/v1", "b/v1": "a/v1", "c/v1": ""},
+			order:   []string{"c/v1"},
+			errs: map[string]string{
+				"a/v1": "parent recipe missing/v1 not found",
+				"b/v1": "parent recipe a/v1 is invalid: parent recipe missing/v1 not found",
+			},
+		},
+		{
+			name:    "parent cycle",
+			parents: map[string]string{"a/v1": "b/v1", "b/v1": "a/v1", "c/v1": "a/v1"},
+			order:   []string{},
+			errs: map[string]string{
+				"a/v1": "parent cycle a/v1 -> b/v1 -> a/v1",
+				"b/v1": "parent cycle a/v1 -> b/v1 -> a/v1",
+				"c/v1": "parent recipe a/v1 is invalid: parent cycle a/v1 -> b/v1 -> a/v1",
+			},
+		},
+		{
+			name:    "self parent",
+			parents: map[string]string{"a/v1": "a/v1"},
+			order:   []string{},
+			errs:    map[string]string{"a/v1": "parent cycle a/v1 -> a/v1"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			order, errs := SortRecipes(test.parents)
+			if !reflect.DeepEqual(order, test.order) {
+				t.Errorf("order = %v, want %v", order, test.order)
+			}
+			got := make(map[string]string)
+			for recipe, err := range errs {
+				got[recipe] = err.Error()
+			}
+			if !reflect.DeepEqual(got, test.errs) {
+				t.Errorf("errs = %v, want %v", got, test.errs)
+			}
+		})
+	}
+}
+
+func TestSortRecipesDepth(t *testing.T) {
+	defer func(depth int) { MaxRecipeDepth = depth }(MaxRecipeDepth)
+	MaxRecipeDepth = 2
+	parents := map[string]string{"a/v1": "", "b/v1": "a/v1", "c/v1": "b/v1", "d/v1": "c/v1", "e/v1": "d/v1"}
+
+	order, errs := SortRecipes(parents)
+	if want := []string{"a/v1", "b/v1", "c/v1"}; !reflect.DeepEqual(order, want) {
+		t.Errorf("order = %v, want %v", order, want)
+	}
+	if err := errs["d/v1"]; err == nil || err.Error() != "recipe d/v1 has more than 2 ancestors: d/v1 -> c/v1 -> b/v1 -> a/v1" {
+		t.Errorf("errs[d/v1] = %v", err)
+	}
+	if err := errs["e/v1"]; err == nil || !strings.HasPrefix(err.Error(), "parent recipe d/v1 is invalid") {
+		t.Errorf("errs[e/v1] = %v", err)
+	}
+
+	MaxRecipeDepth = 0
+	if order, errs := SortRecipes(parents); len(order) != len(parents) || len(errs) != 0 {
+		t.Errorf("no depth limit: order = %v, errs = %v", order, errs)
+	}
+}
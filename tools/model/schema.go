@@ -0,0 +1,253 @@
+package goterragit
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// jsonSchemaVersion is the JSON Schema draft of generated schemas
+const jsonSchemaVersion = "http://json-schema.org/draft-07/schema#"
+
+// Schema is a JSON Schema, limited to the keywords used by catalog definitions
+type Schema struct {
+	Schema               string             `json:"$schema,omitempty"`
+	Title                string             `json:"title,omitempty"`
+	Type                 []string           `json:"type,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	AdditionalProperties interface{}        `json:"additionalProperties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	OneOf                []*Schema          `json:"oneOf,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+}
+
+// definitions maps the root key of definition files to their definition struct
+var definitions = map[string]interface{}{
+	"recipe":      RecipeDefinition{},
+	"template":    TemplateDefinition{},
+	"endpoint":    EndpointDefinition{},
+	"application": ApplicationDefinition{},
+}
+
+// requiredFields are the mandatory keys of definitions, as checked by Check()
+var requiredFields = map[reflect.Type][]string{
+	reflect.TypeOf(Recipe{}):      {"name", "license"},
+	reflect.TypeOf(Template{}):    {"name", "license", "files"},
+	reflect.TypeOf(Endpoint{}):    {"name", "kind", "config", "images"},
+	reflect.TypeOf(Application{}): {"name", "template"},
+}
+
+// DefinitionKinds returns the root keys of definition files (recipe, template, endpoint, application)
+func DefinitionKinds() []string {
+	kinds := make([]string, 0, len(definitions))
+	for kind := range definitions {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	return kinds
+}
+
+// DefinitionSchema returns the JSON Schema of definition files of kind (recipe, template, endpoint, application)
+func DefinitionSchema(kind string) (*Schema, error) {
+	def, ok := definitions[kind]
+	if !ok {
+		return nil, fmt.Errorf("unknown definition kind %s", kind)
+	}
+	s := schemaOf(reflect.TypeOf(def))
+	s.Schema = jsonSchemaVersion
+	s.Title = fmt.Sprintf("goterra %s definition", kind)
+	s.Required = []string{kind}
+	return s, nil
+}
+
+// yamlName returns the yaml key of a struct field, empty if field is not read from yaml
+func yamlName(field reflect.StructField) string {
+	tag := field.Tag.Get("yaml")
+	name := strings.Split(tag, ",")[0]
+	if tag == "" || name == "-" {
+		// Fields without tag, like Path, are set by tools
+		return ""
+	}
+	return name
+}
+
+// schemaOf returns the schema of values of type t, as read by yaml
+func schemaOf(t reflect.Type) *Schema {
+	if t == reflect.TypeOf(Input{}) {
+		// Description only, or full definition
+		return &Schema{OneOf: []*Schema{{Type: []string{"string"}}, structSchema(t)}}
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		return schemaOf(t.Elem())
+	case reflect.String:
+		return &Schema{Type: []string{"string"}}
+	case reflect.Bool:
+		return &Schema{Type: []string{"boolean"}}
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		return &Schema{Type: []string{"integer"}}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: []string{"number"}}
+	case reflect.Slice:
+		return &Schema{Type: []string{"array"}, Items: schemaOf(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: []string{"object"}, AdditionalProperties: schemaOf(t.Elem())}
+	case reflect.Struct:
+		return structSchema(t)
+	}
+	return &Schema{}
+}
+
+// structSchema returns the schema of a struct, with the fields read from yaml
+func structSchema(t reflect.Type) *Schema {
+	s := &Schema{Type: []string{"object"}, Properties: make(map[string]*Schema), AdditionalProperties: false}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := yamlName(field)
+		if name == "" {
+			continue
+		}
+		prop := schemaOf(field.Type)
+		if field.Type.Kind() != reflect.Struct && len(prop.Type) > 0 {
+			// null is read as empty value
+			prop.Type = append(prop.Type, "null")
+		}
+		s.Properties[name] = prop
+	}
+	s.Required = requiredFields[t]
+	if t == reflect.TypeOf(Input{}) {
+		s.Properties["type"].Enum = []string{InputString, InputInt, InputBool, InputEnum, InputSecret}
+	}
+	return s
+}
+
+// nodeType returns the JSON type of a yaml node
+func nodeType(node *yamlv3.Node) string {
+	switch node.Kind {
+	case yamlv3.MappingNode:
+		return "object"
+	case yamlv3.SequenceNode:
+		return "array"
+	case yamlv3.ScalarNode:
+		switch node.ShortTag() {
+		case "!!null":
+			return "null"
+		case "!!bool":
+			return "boolean"
+		case "!!int":
+			return "integer"
+		case "!!float":
+			return "number"
+		}
+		return "string"
+	}
+	return "null"
+}
+
+// hasType tells if JSON type of node is one of types (integer is a number)
+//
+// Int, float and bool scalars are also strings, as read in string fields, like count: 2
+// in defaults or description: yes
+func hasType(types []string, node *yamlv3.Node) bool {
+	if len(types) == 0 {
+		return true
+	}
+	valueType := nodeType(node)
+	for _, t := range types {
+		if t == valueType || (t == "number" && valueType == "integer") {
+			return true
+		}
+		if t == "string" && (valueType == "integer" || valueType == "number" || valueType == "boolean") {
+			return true
+		}
+	}
+	return false
+}
+
+// validate checks a yaml node against schema, errors are added to errs with the node position
+func (s *Schema) validate(path string, node *yamlv3.Node, errs *DecodeErrors) {
+	if node.Kind == yamlv3.AliasNode && node.Alias != nil {
+		node = node.Alias
+	}
+	fail := func(n *yamlv3.Node, path string, format string, args ...interface{}) {
+		*errs = append(*errs, &DecodeError{Line: n.Line, Column: n.Column, Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+	if len(s.OneOf) > 0 {
+		// Report errors of the form with matching type, if any
+		var candidate *Schema
+		for _, form := range s.OneOf {
+			formErrs := make(DecodeErrors, 0)
+			form.validate(path, node, &formErrs)
+			if len(formErrs) == 0 {
+				return
+			}
+			if candidate == nil && hasType(form.Type, node) {
+				candidate = form
+			}
+		}
+		if candidate == nil {
+			fail(node, path, "unexpected %s", nodeType(node))
+			return
+		}
+		candidate.validate(path, node, errs)
+		return
+	}
+	if !hasType(s.Type, node) {
+		fail(node, path, "expected %s, got %s", strings.Join(s.Type, " or "), nodeType(node))
+		return
+	}
+	if len(s.Enum) > 0 && nodeType(node) != "null" {
+		allowed := false
+		for _, v := range s.Enum {
+			if v == node.Value {
+				allowed = true
+			}
+		}
+		if !allowed {
+			fail(node, path, "%s is not one of %s", node.Value, strings.Join(s.Enum, ", "))
+		}
+	}
+	switch node.Kind {
+	case yamlv3.SequenceNode:
+		if s.Items != nil {
+			for i, item := range node.Content {
+				s.Items.validate(fmt.Sprintf("%s[%d]", path, i), item, errs)
+			}
+		}
+	case yamlv3.MappingNode:
+		keys := make(map[string]*yamlv3.Node)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			keyPath := key.Value
+			if path != "" {
+				keyPath = path + "." + key.Value
+			}
+			if first, ok := keys[key.Value]; ok {
+				fail(key, keyPath, "duplicate key, already defined at line %d", first.Line)
+				continue
+			}
+			keys[key.Value] = key
+			if prop, ok := s.Properties[key.Value]; ok {
+				prop.validate(keyPath, value, errs)
+				continue
+			}
+			switch additional := s.AdditionalProperties.(type) {
+			case bool:
+				if !additional {
+					fail(key, keyPath, "unknown key")
+				}
+			case *Schema:
+				additional.validate(keyPath, value, errs)
+			}
+		}
+		for _, required := range s.Required {
+			if _, ok := keys[required]; !ok {
+				fail(node, path, "missing key %s", required)
+			}
+		}
+	}
+}
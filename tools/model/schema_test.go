@@ -0,0 +1,69 @@
+package goterragit
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestDefinitionSchema(t *testing.T) {
+	for _, kind := range DefinitionKinds() {
+		s, err := DefinitionSchema(kind)
+		if err != nil {
+			t.Fatalf("DefinitionSchema(%s) unexpected error: %s", kind, err)
+		}
+		if s.Schema != jsonSchemaVersion || !reflect.DeepEqual(s.Required, []string{kind}) {
+			t.Errorf("%s schema: $schema = %s, required = %v", kind, s.Schema, s.Required)
+		}
+		if _, ok := s.Properties[kind]; !ok {
+			t.Errorf("%s schema has no %s property", kind, kind)
+		}
+	}
+	if _, err := DefinitionSchema("unknown"); err == nil {
+		t.Errorf("DefinitionSchema(unknown) expected an error")
+	}
+}
+
+func TestInputSchema(t *testing.T) {
+	s, err := DefinitionSchema("recipe")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	inputs := s.Properties["recipe"].Properties["inputs"]
+	if !reflect.DeepEqual(inputs.Type, []string{"object", "null"}) {
+		t.Errorf("inputs type = %v, want [object null]", inputs.Type)
+	}
+	input, ok := inputs.AdditionalProperties.(*Schema)
+	if !ok {
+		t.Fatalf("inputs additionalProperties = %v, want a schema", inputs.AdditionalProperties)
+	}
+	data, err := json.Marshal(input)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	var got map[string]interface{}
+	json.Unmarshal(data, &got)
+	var want map[string]interface{}
+	json.Unmarshal([]byte(`{
+		"oneOf": [
+			{"type": ["string"]},
+			{
+				"type": ["object"],
+				"additionalProperties": false,
+				"properties": {
+					"description": {"type": ["string", "null"]},
+					"type": {"type": ["string", "null"], "enum": ["string", "int", "bool", "enum", "secret"]},
+					"required": {"type": ["boolean", "null"]},
+					"default": {"type": ["string", "null"]},
+					"regex": {"type": ["string", "null"]},
+					"min": {"type": ["integer", "null"]},
+					"max": {"type": ["integer", "null"]},
+					"values": {"type": ["array", "null"], "items": {"type": ["string"]}}
+				}
+			}
+		]
+	}`), &want)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("input schema = %s", data)
+	}
+}
@@ -0,0 +1,149 @@
+package goterragit
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// LatestVersion is the constraint matching the highest version
+const LatestVersion = "latest"
+
+// Version is the version of a catalog item, its directory name, like v1.0
+//
+// Versions are semantic versions, with optional v prefix and minor and patch numbers
+type Version struct {
+	Major int
+	Minor int
+	Patch int
+	Pre   string
+	// parts is the number of numbers set in version
+	parts int
+}
+
+// versionPattern matches [v]major[.minor[.patch]][-prerelease]
+var versionPattern = regexp.MustCompile(`^v?(\d+)(?:\.(\d+))?(?:\.(\d+))?(?:-([0-9A-Za-z.-]+))?$`)
+
+// ParseVersion parses a version like v1.0, 1.2.3 or v2.0-beta
+func ParseVersion(s string) (Version, error) {
+	match := versionPattern.FindStringSubmatch(s)
+	if match == nil {
+		return Version{}, fmt.Errorf("invalid version %s, expecting [v]major[.minor[.patch]][-prerelease]", s)
+	}
+	v := Version{Pre: match[4]}
+	numbers := []*int{&v.Major, &v.Minor, &v.Patch}
+	for i, number := range match[1:4] {
+		if number == "" {
+			break
+		}
+		*numbers[i], _ = strconv.Atoi(number)
+		v.parts++
+	}
+	return v, nil
+}
+
+// Compare returns -1, 0 or 1 if v is lower, equal or greater than other, prereleases are lower than releases
+func (v Version) Compare(other Version) int {
+	for _, diff := range []int{compareInts(v.Major, other.Major), compareInts(v.Minor, other.Minor), compareInts(v.Patch, other.Patch)} {
+		if diff != 0 {
+			return diff
+		}
+	}
+	switch {
+	case v.Pre == other.Pre:
+		return 0
+	case v.Pre == "":
+		return 1
+	case other.Pre == "":
+		return -1
+	}
+	return comparePrerelease(v.Pre, other.Pre)
+}
+
+// numericIdentifier matches numeric prerelease identifiers
+var numericIdentifier = regexp.MustCompile(`^\d+$`)
+
+// comparePrerelease compares prereleases by their dot-separated identifiers, as semver does:
+// numeric identifiers are compared as numbers and are lower than alphanumeric ones,
+// a prerelease is lower than a longer one with the same first identifiers
+func comparePrerelease(a string, b string) int {
+	ids, otherIds := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(ids) && i < len(otherIds); i++ {
+		numeric, otherNumeric := numericIdentifier.MatchString(ids[i]), numericIdentifier.MatchString(otherIds[i])
+		switch {
+		case numeric && otherNumeric:
+			n, _ := strconv.Atoi(ids[i])
+			otherN, _ := strconv.Atoi(otherIds[i])
+			if n != otherN {
+				return compareInts(n, otherN)
+			}
+		case numeric:
+			return -1
+		case otherNumeric:
+			return 1
+		case ids[i] != otherIds[i]:
+			return strings.Compare(ids[i], otherIds[i])
+		}
+	}
+	return compareInts(len(ids), len(otherIds))
+}
+
+// compareInts returns -1, 0 or 1 if a is lower, equal or greater than b
+func compareInts(a int, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// Constraint is a version constraint of a reference
+type Constraint struct {
+	// op is latest, ^, ~ or = (exact version)
+	op      string
+	version Version
+}
+
+// ParseConstraint parses a constraint: latest, ^1.0 (same major), ~1.2 (same minor) or a version (=1.0 or 1.0)
+func ParseConstraint(s string) (Constraint, error) {
+	if s == LatestVersion {
+		return Constraint{op: LatestVersion}, nil
+	}
+	op := "="
+	if strings.HasPrefix(s, "^") || strings.HasPrefix(s, "~") || strings.HasPrefix(s, "=") {
+		op = s[:1]
+		s = s[1:]
+	}
+	v, err := ParseVersion(s)
+	if err != nil {
+		return Constraint{}, err
+	}
+	return Constraint{op: op, version: v}, nil
+}
+
+// Match tells if v matches constraint, prereleases only match exact versions
+func (c Constraint) Match(v Version) bool {
+	if c.op == "=" {
+		return v.Compare(c.version) == 0
+	}
+	if v.Pre != "" {
+		return false
+	}
+	if c.op == LatestVersion {
+		return true
+	}
+	if v.Compare(c.version) < 0 {
+		return false
+	}
+	switch {
+	case c.op == "~" && c.version.parts > 1:
+		return v.Major == c.version.Major && v.Minor == c.version.Minor
+	case c.version.Major == 0 && c.version.parts > 1:
+		// ^0.x allows patches only, as minor versions may break
+		return v.Major == 0 && v.Minor == c.version.Minor
+	}
+	return v.Major == c.version.Major
+}
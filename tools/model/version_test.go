@@ -0,0 +1,118 @@
+package goterragit
+
+import (
+	"testing"
+)
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		version string
+		want    Version
+		err     bool
+	}{
+		{version: "v1", want: Version{Major: 1, parts: 1}},
+		{version: "v1.2", want: Version{Major: 1, Minor: 2, parts: 2}},
+		{version: "1.2.3", want: Version{Major: 1, Minor: 2, Patch: 3, parts: 3}},
+		{version: "v2.0-beta.1", want: Version{Major: 2, Pre: "beta.1", parts: 2}},
+		{version: "", err: true},
+		{version: "latest", err: true},
+		{version: "v1.2.3.4", err: true},
+		{version: "v1.x", err: true},
+		{version: "v1.0-", err: true},
+	}
+	for _, test := range tests {
+		v, err := ParseVersion(test.version)
+		if test.err {
+			if err == nil {
+				t.Errorf("ParseVersion(%q) = %+v, want error", test.version, v)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseVersion(%q) unexpected error: %s", test.version, err)
+			continue
+		}
+		if v != test.want {
+			t.Errorf("ParseVersion(%q) = %+v, want %+v", test.version, v, test.want)
+		}
+	}
+}
+
+func TestCompare(t *testing.T) {
+	tests := []struct {
+		a    string
+		b    string
+		want int
+	}{
+		{a: "v1.0", b: "v1", want: 0},
+		{a: "v1.0", b: "1.0.0", want: 0},
+		{a: "v1.1", b: "v1.0", want: 1},
+		{a: "v1.9", b: "v1.10", want: -1},
+		{a: "v2.0", b: "v1.10.3", want: 1},
+		{a: "v1.0-beta", b: "v1.0", want: -1},
+		{a: "v1.0-beta", b: "v1.0-alpha", want: 1},
+		{a: "v1.0-beta.2", b: "v1.0-beta.11", want: -1},
+		{a: "v1.0-1", b: "v1.0-beta", want: -1},
+		{a: "v1.0-beta", b: "v1.0-beta.1", want: -1},
+	}
+	for _, test := range tests {
+		a, _ := ParseVersion(test.a)
+		b, _ := ParseVersion(test.b)
+		if got := a.Compare(b); got != test.want {
+			t.Errorf("%s compared to %s = %d, want %d", test.a, test.b, got, test.want)
+		}
+		if got := b.Compare(a); got != -test.want {
+			t.Errorf("%s compared to %s = %d, want %d", test.b, test.a, got, -test.want)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		constraint string
+		version    string
+		want       bool
+	}{
+		{constraint: "latest", version: "v3.2", want: true},
+		{constraint: "latest", version: "v3.2-beta", want: false},
+		{constraint: "v1.0", version: "v1.0", want: true},
+		{constraint: "v1.0", version: "v1.0.0", want: true},
+		{constraint: "v1.0", version: "v1.1", want: false},
+		{constraint: "=v1.0-beta", version: "v1.0-beta", want: true},
+		{constraint: "^1.1", version: "v1.1", want: true},
+		{constraint: "^1.1", version: "v1.5.2", want: true},
+		{constraint: "^1.1", version: "v1.0", want: false},
+		{constraint: "^1.1", version: "v2.0", want: false},
+		{constraint: "^1.1", version: "v1.6-beta", want: false},
+		{constraint: "^0.2", version: "v0.2.5", want: true},
+		{constraint: "^0.2", version: "v0.3", want: false},
+		{constraint: "^0", version: "v0.3", want: true},
+		{constraint: "~1.2", version: "v1.2.7", want: true},
+		{constraint: "~1.2", version: "v1.3", want: false},
+		{constraint: "~1", version: "v1.3", want: true},
+		{constraint: "~1", version: "v2.0", want: false},
+	}
+	for _, test := range tests {
+		c, err := ParseConstraint(test.constraint)
+		if err != nil {
+			t.Errorf("ParseConstraint(%q) unexpected error: %s", test.constraint, err)
+			continue
+		}
+		v, err := ParseVersion(test.version)
+		if err != nil {
+			t.Errorf("ParseVersion(%q) unexpected error: %s", test.version, err)
+			continue
+		}
+		if got := c.Match(v); got != test.want {
+			t.Errorf("%s matches %s = %t, want %t", test.version, test.constraint, got, test.want)
+		}
+	}
+}
+
+func TestParseConstraintInvalid(t *testing.T) {
+	for _, constraint := range []string{"", "^", ">1.0", "^latest", "~v1.x"} {
+		if _, err := ParseConstraint(constraint); err == nil {
+			t.Errorf("ParseConstraint(%q) expected an error", constraint)
+		}
+	}
+}